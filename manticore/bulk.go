@@ -0,0 +1,550 @@
+package manticore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BulkAction is the kind of statement which BulkIndexer builds for the batch of documents.
+type BulkAction int
+
+const (
+	BulkInsert BulkAction = iota
+	BulkReplace
+	BulkDelete
+)
+
+// Stringer interface for BulkAction type
+func (vl BulkAction) String() string {
+	switch vl {
+	case BulkInsert:
+		return "INSERT"
+	case BulkReplace:
+		return "REPLACE"
+	case BulkDelete:
+		return "DELETE"
+	default:
+		return fmt.Sprintf("BulkAction(%d)", int(vl))
+	}
+}
+
+// sqlLiteral formats Go value as sphinxql literal for INSERT/REPLACE: strings and []byte are quoted, integers and
+// floats are written as is, bools as 0/1, time.Time as unix timestamp, slices of integers as MVA, and maps, structs
+// and json.RawMessage as quoted JSON.
+func sqlLiteral(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "", errors.New("nil value")
+	case string:
+		return quoteSQLString(v), nil
+	case []byte:
+		return quoteSQLString(string(v)), nil
+	case bool:
+		return strconv.Itoa(boolInt(v)), nil
+	case float32:
+		return formatSQLFloat(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Time:
+		return strconv.FormatInt(v.Unix(), 10), nil
+	case json.RawMessage:
+		if !json.Valid(v) {
+			return "", errors.New("invalid JSON")
+		}
+		return quoteSQLString(string(v)), nil
+	}
+	if num, ok := updateInteger(val); ok {
+		return strconv.FormatInt(num, 10), nil
+	}
+	if nums, ok := updateIntegers(val); ok {
+		items := make([]string, len(nums))
+		for i, num := range nums {
+			items[i] = strconv.FormatInt(num, 10)
+		}
+		return "(" + strings.Join(items, ",") + ")", nil
+	}
+	blob, err := json.Marshal(val)
+	if err != nil {
+		return "", fmt.Errorf("unsupported value of type %T", val)
+	}
+	return quoteSQLString(string(blob)), nil
+}
+
+// docColumns returns sorted names of document columns
+func docColumns(doc map[string]interface{}) []string {
+	columns := make([]string, 0, len(doc))
+	for column := range doc {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// docRow formats document as list of values `(id,v1,v2...)` in the order of `columns`
+func docRow(id DocID, doc map[string]interface{}, columns []string) (string, error) {
+	items := make([]string, len(columns)+1)
+	items[0] = strconv.FormatUint(uint64(id), 10)
+	for i, column := range columns {
+		if column == "id" {
+			return "", errors.New("'id' column must not be in the document, it is passed separately")
+		}
+		literal, err := sqlLiteral(doc[column])
+		if err != nil {
+			return "", fmt.Errorf("doc %d, column '%s': %v", id, column, err)
+		}
+		items[i+1] = literal
+	}
+	return "(" + strings.Join(items, ",") + ")", nil
+}
+
+// insertStatement builds multi-row INSERT or REPLACE statement from rows made by docRow()
+func insertStatement(action BulkAction, index string, columns, rows []string) string {
+	return fmt.Sprintf("%v INTO %s (%s) VALUES %s", action, index, strings.Join(append([]string{"id"}, columns...),
+		","), strings.Join(rows, ","))
+}
+
+// deleteStatement builds DELETE statement for documents `ids`
+func deleteStatement(index string, ids []DocID) string {
+	items := make([]string, len(ids))
+	for i, id := range ids {
+		items[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", index, strings.Join(items, ","))
+}
+
+// BulkBatchStats describes one batch processed by BulkIndexer, as passed to BulkIndexerOptions.OnBatch.
+type BulkBatchStats struct {
+	Index    string
+	Action   BulkAction
+	Docs     int           // number of documents in the batch
+	Bytes    int           // size of the statement
+	Attempts int           // number of tries, including retries
+	Affected int           // number of rows affected, as reported by daemon
+	Duration time.Duration // total time of all the attempts
+	Err      error         // error of the last attempt, or nil if the batch succeeded
+}
+
+// BulkIndexerStats are totals of BulkIndexer since it was created.
+type BulkIndexerStats struct {
+	Batches, FailedBatches int
+	Docs, FailedDocs       int
+	Retries                int
+}
+
+// BulkIndexerOptions used to tune BulkIndexer. All fields are exported and have meaning described below.
+//
+// Workers
+//
+// Number of goroutines which send batches, each one over it's own connection.
+//
+// BatchDocs
+//
+// Batch is flushed when it has so many documents. 0 means no limit.
+//
+// BatchBytes
+//
+// Batch is flushed before the statement grows over so many bytes. Keep it below max_packet_size of the daemon.
+// 0 means no limit.
+//
+// FlushInterval
+//
+// All the pending batches are flushed with such period, so documents don't wait too long when the flow is low.
+// 0 disables periodic flushing.
+//
+// Retries
+//
+// How many times failed batch is retried before it is reported as failed. Only connection failures and temporary
+// searchd errors are retried; errors of the statement itself (syntax, unknown column, duplicate id) fail the batch
+// right away. Note that if connection breaks after the daemon applied the batch, retry of BulkInsert fails with
+// duplicate id; use BulkReplace where retries must be idempotent.
+//
+// RetryDelay
+//
+// Pause before the first retry; it doubles on every next retry.
+//
+// OnBatch
+//
+// Called after every batch, successful or not. It is called from the worker goroutines, so it must be safe for
+// concurrent use. It must not call methods of the indexer itself (Insert, Delete, Flush, Close): the worker which
+// called it doesn't take batches meanwhile, and the indexer may deadlock.
+type BulkIndexerOptions struct {
+	Workers       int
+	BatchDocs     int
+	BatchBytes    int
+	FlushInterval time.Duration
+	Retries       int
+	RetryDelay    time.Duration
+	OnBatch       func(BulkBatchStats)
+}
+
+// Create default BulkIndexerOptions with following defaults:
+//
+//  Workers: 2
+//  BatchDocs: 1000
+//  BatchBytes: 4194304 (4M)
+//  FlushInterval: 1s
+//  Retries: 3
+//  RetryDelay: 100ms
+//  OnBatch: nil
+func NewBulkIndexerOptions() *BulkIndexerOptions {
+	res := BulkIndexerOptions{
+		2,
+		1000,
+		4 * 1024 * 1024,
+		time.Second,
+		3,
+		100 * time.Millisecond,
+		nil,
+	}
+	return &res
+}
+
+// bulkBatch is pending batch of documents of one index, action and set of columns
+type bulkBatch struct {
+	key     string
+	index   string
+	action  BulkAction
+	columns []string
+	rows    []string
+	ids     []DocID
+	size    int
+}
+
+func (b *bulkBatch) docs() int {
+	if b.action == BulkDelete {
+		return len(b.ids)
+	}
+	return len(b.rows)
+}
+
+func (b *bulkBatch) statement() string {
+	if b.action == BulkDelete {
+		return deleteStatement(b.index, b.ids)
+	}
+	return insertStatement(b.action, b.index, b.columns, b.rows)
+}
+
+/*
+BulkIndexer collects documents for RT indexes, and sends them in batches as multi-row INSERT or REPLACE statements
+and DELETE ... WHERE id IN (...) statements. Batch is sent when it reaches BatchDocs documents or BatchBytes bytes,
+on periodic flush, or on explicit Flush() and Close().
+
+Documents of one batch have the same index, action and set of columns. When action or columns change, pending
+batch of the index is sent before the new one is started, so with one worker the changes of an index are applied
+in the order they were added. Several workers send batches in parallel, so the order is not guaranteed then.
+
+Failed batches are retried, and then reported via OnBatch callback and counted in Stats(). Unlike Client,
+BulkIndexer is safe for concurrent use. Insert(), Replace() and Delete() block when all the workers are busy
+and the queue is full.
+
+Usage example:
+
+  cl := NewClient()
+  bi := NewBulkIndexer(&cl)
+  for id, doc := range docs {
+    if err := bi.Insert("products", id, map[string]interface{}{"title": doc.Title, "price": doc.Price}); err != nil {
+      fmt.Println(err.Error())
+    }
+  }
+  if err := bi.Close(); err != nil {
+    fmt.Println(err.Error())
+  }
+*/
+type BulkIndexer struct {
+	opts    BulkIndexerOptions
+	clients []Client
+	queue   chan *bulkBatch
+
+	mu      sync.Mutex
+	pending map[string]*bulkBatch
+	order   []string
+	last    map[string]string // index -> key of the last batch
+	closed  bool
+
+	done     sync.Mutex
+	cond     *sync.Cond
+	inflight int
+	stats    BulkIndexerStats
+
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+/*
+NewBulkIndexer creates bulk indexer, which sends documents to the daemon `cl` is set to. Client itself is not used
+for requests, instead every worker opens it's own persistent connection with the same settings.
+
+`opts` is an optional struct BulkIndexerOptions, it may be created by calling NewBulkIndexerOptions() and then tuned.
+If `opts` is omitted, default will be used.
+*/
+func NewBulkIndexer(cl *Client, opts ...BulkIndexerOptions) *BulkIndexer {
+	var popts BulkIndexerOptions
+	if len(opts) > 0 {
+		popts = opts[0]
+	} else {
+		popts = *NewBulkIndexerOptions()
+	}
+	if popts.Workers <= 0 {
+		popts.Workers = 1
+	}
+
+	b := &BulkIndexer{
+		opts:    popts,
+		clients: make([]Client, popts.Workers),
+		queue:   make(chan *bulkBatch, popts.Workers),
+		pending: make(map[string]*bulkBatch),
+		last:    make(map[string]string),
+		stop:    make(chan struct{}),
+	}
+	b.cond = sync.NewCond(&b.done)
+	for w := range b.clients {
+		b.clients[w] = cl.clone()
+		b.workers.Add(1)
+		go b.worker(&b.clients[w])
+	}
+	if popts.FlushInterval > 0 {
+		go b.ticker(popts.FlushInterval)
+	}
+	return b
+}
+
+// Insert adds document with given id into INSERT batch of the index. Document maps column names to values, see
+// sqlLiteral() for supported Go types. Values are validated right away, and error is returned for wrong ones.
+func (b *BulkIndexer) Insert(index string, id DocID, doc map[string]interface{}) error {
+	return b.add(BulkInsert, index, id, doc)
+}
+
+// Replace works like Insert, but adds the document into REPLACE batch.
+func (b *BulkIndexer) Replace(index string, id DocID, doc map[string]interface{}) error {
+	return b.add(BulkReplace, index, id, doc)
+}
+
+// Delete adds documents with given ids into DELETE batch of the index.
+func (b *BulkIndexer) Delete(index string, ids ...DocID) error {
+	if index == "" {
+		return errors.New("invalid arguments (index must not be empty)")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("bulk indexer is closed")
+	}
+	for _, id := range ids {
+		size := len(strconv.FormatUint(uint64(id), 10)) + 1
+		batch := b.batch(BulkDelete, index, nil, size)
+		batch.ids = append(batch.ids, id)
+		batch.size += size
+		b.flushFull(batch)
+	}
+	return nil
+}
+
+func (b *BulkIndexer) add(action BulkAction, index string, id DocID, doc map[string]interface{}) error {
+	if index == "" {
+		return errors.New("invalid arguments (index must not be empty)")
+	}
+	if len(doc) == 0 {
+		return errors.New("invalid arguments (doc must not be empty)")
+	}
+	columns := docColumns(doc)
+	row, err := docRow(id, doc, columns)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("bulk indexer is closed")
+	}
+	size := len(row) + 1
+	batch := b.batch(action, index, columns, size)
+	batch.rows = append(batch.rows, row)
+	batch.size += size
+	b.flushFull(batch)
+	return nil
+}
+
+// batch returns pending batch for given key, which has room for `size` more bytes. Must be called under b.mu
+func (b *BulkIndexer) batch(action BulkAction, index string, columns []string, size int) *bulkBatch {
+	key := fmt.Sprintf("%d %s %s", action, index, strings.Join(columns, ","))
+	if last := b.last[index]; last != key {
+		if _, ok := b.pending[last]; ok {
+			b.send(last)
+		}
+		b.last[index] = key
+	}
+	batch, ok := b.pending[key]
+	if ok && b.opts.BatchBytes > 0 && batch.size+size > b.opts.BatchBytes {
+		b.send(key)
+		ok = false
+	}
+	if !ok {
+		batch = &bulkBatch{key: key, index: index, action: action, columns: columns}
+		if action == BulkDelete {
+			batch.size = len(deleteStatement(index, nil))
+		} else {
+			batch.size = len(insertStatement(action, index, columns, nil))
+		}
+		b.pending[key] = batch
+		b.order = append(b.order, key)
+	}
+	return batch
+}
+
+// flushFull sends the batch if it reached document limit. Must be called under b.mu
+func (b *BulkIndexer) flushFull(batch *bulkBatch) {
+	if b.opts.BatchDocs > 0 && batch.docs() >= b.opts.BatchDocs {
+		b.send(batch.key)
+	}
+}
+
+// send passes pending batch with given key to the workers. Must be called under b.mu
+func (b *BulkIndexer) send(key string) {
+	batch := b.pending[key]
+	delete(b.pending, key)
+	for i, k := range b.order {
+		if k == key {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			break
+		}
+	}
+	b.done.Lock()
+	b.inflight++
+	b.done.Unlock()
+	b.queue <- batch
+}
+
+// sendAll passes all the pending batches to the workers, in the order they were started. Must be called under b.mu
+func (b *BulkIndexer) sendAll() {
+	for len(b.order) > 0 {
+		b.send(b.order[0])
+	}
+}
+
+func (b *BulkIndexer) ticker(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			b.mu.Lock()
+			if !b.closed {
+				b.sendAll()
+			}
+			b.mu.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *BulkIndexer) worker(cl *Client) {
+	defer b.workers.Done()
+	for batch := range b.queue {
+		stats := b.process(cl, batch)
+		if b.opts.OnBatch != nil {
+			b.opts.OnBatch(stats)
+		}
+
+		b.done.Lock()
+		b.stats.Batches++
+		b.stats.Docs += stats.Docs
+		b.stats.Retries += stats.Attempts - 1
+		if stats.Err != nil {
+			b.stats.FailedBatches++
+			b.stats.FailedDocs += stats.Docs
+		}
+		b.inflight--
+		b.cond.Broadcast()
+		b.done.Unlock()
+	}
+	if cl.connected {
+		_, _ = cl.Close()
+	}
+}
+
+// retryable tells whether failed batch may succeed if sent again
+func retryable(cl *Client, err error) bool {
+	return cl.IsConnectError() || networkError(err) || strings.HasPrefix(err.Error(), "temporary searchd error")
+}
+
+// process sends batch over the worker's connection, retrying on connection and temporary failures
+func (b *BulkIndexer) process(cl *Client, batch *bulkBatch) BulkBatchStats {
+	stmt := batch.statement()
+	stats := BulkBatchStats{batch.index, batch.action, batch.docs(), len(stmt), 0, 0, 0, nil}
+	start := time.Now()
+	delay := b.opts.RetryDelay
+	for {
+		stats.Attempts++
+		stats.Err = nil
+		if !cl.connected {
+			_, stats.Err = cl.Open()
+		}
+		if stats.Err == nil {
+			var rs *Sqlresult
+			if rs, stats.Err = cl.sqlExec(stmt); stats.Err == nil {
+				stats.Affected = rs.RowsAffected
+				break
+			}
+			if cl.connected && brokenConnection(stats.Err) {
+				_, _ = cl.Close() // next attempt or batch reconnects
+			}
+		}
+		if stats.Attempts > b.opts.Retries || !retryable(cl, stats.Err) {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	stats.Duration = time.Since(start)
+	return stats
+}
+
+// Flush sends all the pending batches, and waits until all the sent batches are processed.
+func (b *BulkIndexer) Flush() {
+	b.mu.Lock()
+	b.sendAll()
+	b.mu.Unlock()
+
+	b.done.Lock()
+	for b.inflight > 0 {
+		b.cond.Wait()
+	}
+	b.done.Unlock()
+}
+
+// Stats returns totals of the batches processed so far.
+func (b *BulkIndexer) Stats() BulkIndexerStats {
+	b.done.Lock()
+	defer b.done.Unlock()
+	return b.stats
+}
+
+// Close flushes all the pending batches, waits for them, stops the workers and closes their connections.
+// Returns error if any batch failed since the indexer was created. Indexer can't be used after Close().
+func (b *BulkIndexer) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errors.New("bulk indexer is closed")
+	}
+	b.sendAll()
+	b.closed = true
+	close(b.queue)
+	close(b.stop)
+	b.mu.Unlock()
+
+	b.workers.Wait()
+	stats := b.Stats()
+	if stats.FailedBatches > 0 {
+		return fmt.Errorf("%d of %d batches (%d docs) failed", stats.FailedBatches, stats.Batches, stats.FailedDocs)
+	}
+	return nil
+}
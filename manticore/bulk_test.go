@@ -0,0 +1,221 @@
+package manticore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSqlLiteral(t *testing.T) {
+
+	values := []struct {
+		val      interface{}
+		expected string
+	}{
+		{"it's", `'it\'s'`},
+		{[]byte("raw"), "'raw'"},
+		{true, "1"},
+		{uint64(5000000000), "5000000000"},
+		{-3, "-3"},
+		{float32(1), "1.0"},
+		{2.5, "2.5"},
+		{time.Unix(1500000000, 0), "1500000000"},
+		{[]uint32{1, 2}, "(1,2)"},
+		{[]int64{}, "()"},
+		{map[string]int{"a": 1}, `'{"a":1}'`},
+		{json.RawMessage(`{"b":[1,2]}`), `'{"b":[1,2]}'`},
+	}
+	for _, v := range values {
+		literal, err := sqlLiteral(v.val)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", v.val, err)
+		} else if literal != v.expected {
+			t.Errorf("%v: expected %s, got %s", v.val, v.expected, literal)
+		}
+	}
+
+	for _, val := range []interface{}{nil, json.RawMessage(`{`), make(chan int)} {
+		if _, err := sqlLiteral(val); err == nil {
+			t.Errorf("%v: error expected", val)
+		}
+	}
+}
+
+func TestBulkStatements(t *testing.T) {
+
+	doc := map[string]interface{}{"title": "hello", "gid": 10}
+	columns := docColumns(doc)
+	row, err := docRow(1, doc, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row2, _ := docRow(2, map[string]interface{}{"title": "world", "gid": 11}, columns)
+	stmt := insertStatement(BulkReplace, "rt", columns, []string{row, row2})
+	if stmt != "REPLACE INTO rt (id,gid,title) VALUES (1,10,'hello'),(2,11,'world')" {
+		t.Errorf("unexpected statement %s", stmt)
+	}
+	if stmt = deleteStatement("rt", []DocID{1, 2}); stmt != "DELETE FROM rt WHERE id IN (1,2)" {
+		t.Errorf("unexpected statement %s", stmt)
+	}
+
+	if _, err = docRow(1, map[string]interface{}{"id": 1}, []string{"id"}); err == nil {
+		t.Error("error expected for 'id' column")
+	}
+	if _, err = docRow(1, map[string]interface{}{"gid": nil}, []string{"gid"}); err == nil ||
+		err.Error() != "doc 1, column 'gid': nil value" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestBulkIndexer_batches(t *testing.T) {
+
+	type batch struct {
+		action BulkAction
+		docs   int
+	}
+	var mu sync.Mutex
+	var batches []batch
+
+	opts := NewBulkIndexerOptions()
+	opts.Workers = 1
+	opts.BatchDocs = 2
+	opts.FlushInterval = 0
+	opts.Retries = 0
+	opts.OnBatch = func(stats BulkBatchStats) {
+		mu.Lock()
+		batches = append(batches, batch{stats.Action, stats.Docs})
+		mu.Unlock()
+	}
+
+	cl := NewClient()
+	bi := NewBulkIndexer(&cl, *opts)
+	for id := DocID(1); id <= 3; id++ {
+		if err := bi.Insert("rt", id, map[string]interface{}{"title": "doc"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = bi.Delete("rt", 1)
+	_ = bi.Replace("rt", 4, map[string]interface{}{"title": "doc", "gid": 1})
+	_ = bi.Close() // batches fail without daemon, that's ok here
+
+	expected := []batch{{BulkInsert, 2}, {BulkInsert, 1}, {BulkDelete, 1}, {BulkReplace, 1}}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("unexpected batches %v", batches)
+	}
+	if stats := bi.Stats(); stats.Batches != 4 || stats.Docs != 5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if err := bi.Insert("rt", 5, map[string]interface{}{"title": "doc"}); err == nil {
+		t.Error("error expected after close")
+	}
+}
+
+func TestBulkIndexer_bytes(t *testing.T) {
+
+	var mu sync.Mutex
+	var sizes []int
+
+	opts := NewBulkIndexerOptions()
+	opts.Workers = 1
+	opts.BatchDocs = 0
+	opts.BatchBytes = 100
+	opts.FlushInterval = 0
+	opts.Retries = 0
+	opts.OnBatch = func(stats BulkBatchStats) {
+		mu.Lock()
+		sizes = append(sizes, stats.Bytes)
+		mu.Unlock()
+	}
+
+	cl := NewClient()
+	bi := NewBulkIndexer(&cl, *opts)
+	for id := DocID(1); id <= 10; id++ {
+		_ = bi.Insert("rt", id, map[string]interface{}{"title": "some document"})
+	}
+	bi.Flush()
+	if len(sizes) < 2 {
+		t.Errorf("expected several batches, got %v", sizes)
+	}
+	for _, size := range sizes {
+		if size > 100 {
+			t.Errorf("batch of %d bytes exceeds budget", size)
+		}
+	}
+	_ = bi.Close()
+}
+
+func TestRetryable(t *testing.T) {
+
+	cl := NewClient()
+	if retryable(&cl, errors.New("ERROR 1064 duplicate id '1'")) {
+		t.Error("statement error must not be retried")
+	}
+	if !retryable(&cl, errors.New("temporary searchd error: try again")) {
+		t.Error("temporary error must be retried")
+	}
+	if !retryable(&cl, io.EOF) || !retryable(&cl, &net.OpError{Op: "write", Err: syscall.EPIPE}) {
+		t.Error("broken connection must be retried")
+	}
+	cl.connError = true
+	if !retryable(&cl, errors.New("connection refused")) {
+		t.Error("connection error must be retried")
+	}
+}
+
+func TestBulkIndexer_brokenConnection(t *testing.T) {
+
+	d := newFakeDaemon(t)
+	defer d.Close()
+
+	opts := NewBulkIndexerOptions()
+	opts.Workers = 1
+	opts.FlushInterval = 0
+	opts.RetryDelay = time.Millisecond
+	cl := d.client()
+	bi := NewBulkIndexer(&cl, *opts)
+
+	_ = bi.Insert("rt", 1, map[string]interface{}{"gid": 1})
+	bi.Flush()
+	_ = (<-d.conns).Close() // daemon restarted, or idle connection timed out
+	time.Sleep(10 * time.Millisecond)
+
+	_ = bi.Insert("rt", 2, map[string]interface{}{"gid": 2})
+	bi.Flush()
+	_ = bi.Insert("rt", 3, map[string]interface{}{"gid": 3})
+	if err := bi.Close(); err != nil {
+		t.Error(err)
+	}
+	expected := []string{
+		"INSERT INTO rt (id,gid) VALUES (1,1)",
+		"INSERT INTO rt (id,gid) VALUES (2,2)",
+		"INSERT INTO rt (id,gid) VALUES (3,3)",
+	}
+	if stmts := d.statements(); !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+}
+
+func ExampleBulkIndexer() {
+
+	cl := NewClient()
+	opts := NewBulkIndexerOptions()
+	opts.OnBatch = func(stats BulkBatchStats) {
+		if stats.Err != nil {
+			fmt.Printf("%v of %d docs into %s failed: %v\n", stats.Action, stats.Docs, stats.Index, stats.Err)
+		}
+	}
+	bi := NewBulkIndexer(&cl, *opts)
+	_ = bi.Replace("testrt", 1, map[string]interface{}{"title": "my subject", "content": "my content", "gid": 15})
+	_ = bi.Replace("testrt", 2, map[string]interface{}{"title": "another subject", "content": "more content", "gid": 15})
+	_ = bi.Delete("testrt", 5)
+	if err := bi.Close(); err != nil {
+		fmt.Println(err.Error())
+	}
+}
@@ -0,0 +1,201 @@
+package manticore
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Fingerprint returns deterministic hash of the search query, as hex string. Two Search values which would be sent
+to daemon as the same bytes have the same fingerprint. So it may be used as a key to cache results of the query.
+
+Facets set by AddFacet() are not part of the fingerprint.
+*/
+func (q *Search) Fingerprint() string {
+	var buf apibuf
+	buf.buildSearchRequest(q)
+	sum := sha1.Sum(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+type cacheEntry struct {
+	key     string
+	indexes []string
+	expires time.Time
+	result  QueryResult
+}
+
+type cacheCall struct {
+	wg     sync.WaitGroup
+	result *QueryResult
+	err    error
+}
+
+/*
+ResultCache keeps results of search queries for Client.RunQuery(). It is safe for concurrent use, so one cache may
+be shared by several clients. Attach it to client by calling Client.SetCache().
+
+Entries expire after TTL, and least recently used entries are evicted when number of entries exceeds the limit.
+If several goroutines run identical query at the same time, only one request goes to the daemon, and the rest wait
+for it's result.
+
+Results are keyed by the daemon address together with the query, so clients pointed to different daemons don't
+share results. Result of the query which was in flight while its index was invalidated is not cached.
+
+Only successful results are cached. Cached results are shared between callers, so don't modify them.
+*/
+type ResultCache struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	maxsize  int
+	entries  map[string]*list.Element
+	lru      *list.List // front is most recently used
+	inflight map[string]*cacheCall
+
+	generation  uint64            // incremented by every invalidation
+	invalidated map[string]uint64 // generation of the last invalidation of the index
+	purged      uint64            // generation of the last Purge()
+}
+
+// NewResultCache creates cache which keeps up to `maxsize` results for `ttl` time. Zero `ttl` means no expiration,
+// zero `maxsize` means no size limit.
+func NewResultCache(ttl time.Duration, maxsize int) *ResultCache {
+	return &ResultCache{
+		ttl:      ttl,
+		maxsize:  maxsize,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*cacheCall),
+
+		invalidated: make(map[string]uint64),
+	}
+}
+
+// split list of indexes, as "main, delta;rt" into names
+func splitIndexes(indexes string) []string {
+	return strings.FieldsFunc(indexes, func(c rune) bool {
+		return !(c == '_' || c == '*' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'))
+	})
+}
+
+func (c *ResultCache) lookup(key string) (*QueryResult, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl != 0 && time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	result := entry.result
+	return &result, true
+}
+
+func (c *ResultCache) store(key string, indexes []string, result *QueryResult) {
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	entry := &cacheEntry{key, indexes, time.Now().Add(c.ttl), *result}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.maxsize > 0 && c.lru.Len() > c.maxsize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// stale tells whether any of `indexes` was invalidated after generation `since`
+func (c *ResultCache) stale(indexes []string, since uint64) bool {
+	if c.purged > since {
+		return true
+	}
+	for _, name := range indexes {
+		if c.invalidated[name] > since || (name == "*" && c.generation > since) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ResultCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// fetch returns cached result for query `q` to daemon `server`, or runs `query` to get it, sharing one run between
+// concurrent callers
+func (c *ResultCache) fetch(server string, q *Search, query func() (*QueryResult, error)) (*QueryResult, error) {
+	key := server + "/" + q.Fingerprint()
+	indexes := splitIndexes(q.Indexes)
+
+	c.mutex.Lock()
+	if result, ok := c.lookup(key); ok {
+		c.mutex.Unlock()
+		return result, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mutex.Unlock()
+		call.wg.Wait()
+		return call.result, call.err
+	}
+	call := &cacheCall{err: errors.New("query panicked")} // seen by waiters if query never returns
+	call.wg.Add(1)
+	c.inflight[key] = call
+	generation := c.generation
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		delete(c.inflight, key)
+		if call.err == nil && call.result != nil && call.result.Status != StatusError &&
+			call.result.Status != StatusRetry && !c.stale(indexes, generation) {
+			c.store(key, indexes, call.result)
+		}
+		c.mutex.Unlock()
+		call.wg.Done()
+	}()
+
+	call.result, call.err = query()
+	return call.result, call.err
+}
+
+// InvalidateIndex removes from cache all the results of queries which involved index `index`,
+// as well as results of queries over all indexes ("*").
+func (c *ResultCache) InvalidateIndex(index string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	c.invalidated[index] = c.generation
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		for _, name := range elem.Value.(*cacheEntry).indexes {
+			if name == index || name == "*" {
+				c.remove(elem)
+				break
+			}
+		}
+		elem = next
+	}
+}
+
+// Purge removes all the entries from cache.
+func (c *ResultCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	c.purged = c.generation
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Len returns number of results currently in cache (including expired, but not yet evicted).
+func (c *ResultCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,187 @@
+package manticore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearch_Fingerprint(t *testing.T) {
+	q1 := NewSearch("query", "lj", "")
+	q1.FieldWeights = map[string]int32{"title": 1000, "content": 10, "tags": 5, "author": 3}
+	q2 := NewSearch("query", "lj", "")
+	q2.FieldWeights = map[string]int32{"author": 3, "tags": 5, "content": 10, "title": 1000}
+
+	for i := 0; i < 10; i++ {
+		if q1.Fingerprint() != q2.Fingerprint() {
+			t.Fatalf("same searches have different fingerprints")
+		}
+	}
+
+	q2.FieldWeights["title"] = 100
+	if q1.Fingerprint() == q2.Fingerprint() {
+		t.Errorf("different searches have the same fingerprint")
+	}
+}
+
+func TestResultCache_fetch(t *testing.T) {
+	cache := NewResultCache(time.Hour, 2)
+	calls := 0
+	query := func() (*QueryResult, error) {
+		calls++
+		return &QueryResult{Total: calls}, nil
+	}
+
+	q1, q2, q3 := NewSearch("one", "lj", ""), NewSearch("two", "lj, delta", ""), NewSearch("three", "rt", "")
+	_, _ = cache.fetch("tcp:localhost:9312", &q1, query)
+	res, _ := cache.fetch("tcp:localhost:9312", &q1, query)
+	if calls != 1 || res.Total != 1 {
+		t.Errorf("expected cached result, got %d calls", calls)
+	}
+
+	_, _ = cache.fetch("tcp:localhost:9312", &q2, query)
+	_, _ = cache.fetch("tcp:localhost:9312", &q1, query) // q1 becomes most recent
+	_, _ = cache.fetch("tcp:localhost:9312", &q3, query) // q2 evicted
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.Len())
+	}
+	_, _ = cache.fetch("tcp:localhost:9312", &q2, query)
+	if calls != 4 {
+		t.Errorf("expected q2 to be evicted, got %d calls", calls)
+	}
+
+	cache.InvalidateIndex("delta")
+	_, _ = cache.fetch("tcp:localhost:9312", &q2, query)
+	if calls != 5 {
+		t.Errorf("expected q2 to be invalidated, got %d calls", calls)
+	}
+
+	expired := NewResultCache(time.Nanosecond, 0)
+	_, _ = expired.fetch("tcp:localhost:9312", &q1, query)
+	time.Sleep(time.Millisecond)
+	_, _ = expired.fetch("tcp:localhost:9312", &q1, query)
+	if calls != 7 {
+		t.Errorf("expected expired entry, got %d calls", calls)
+	}
+}
+
+func TestResultCache_singleflight(t *testing.T) {
+	cache := NewResultCache(0, 0)
+	q := NewSearch("query", "lj", "")
+
+	var mutex sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	query := func() (*QueryResult, error) {
+		mutex.Lock()
+		calls++
+		mutex.Unlock()
+		<-release
+		return &QueryResult{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cache.fetch("tcp:localhost:9312", &q, query)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("expected one call for concurrent identical queries, got %d", calls)
+	}
+}
+
+func TestResultCache_servers(t *testing.T) {
+	cache := NewResultCache(0, 0)
+	q := NewSearch("query", "lj", "")
+	calls := 0
+	query := func() (*QueryResult, error) {
+		calls++
+		return &QueryResult{Total: calls}, nil
+	}
+
+	_, _ = cache.fetch("tcp:10.0.0.1:9312", &q, query)
+	res, _ := cache.fetch("tcp:10.0.0.2:9312", &q, query)
+	if calls != 2 || res.Total != 2 {
+		t.Errorf("expected separate results for different daemons, got %d calls", calls)
+	}
+}
+
+func TestResultCache_invalidateInFlight(t *testing.T) {
+	cache := NewResultCache(0, 0)
+	q := NewSearch("query", "lj, delta", "")
+	calls := 0
+	query := func() (*QueryResult, error) {
+		calls++
+		if calls == 1 {
+			cache.InvalidateIndex("delta")
+		}
+		return &QueryResult{}, nil
+	}
+
+	_, _ = cache.fetch("tcp:localhost:9312", &q, query)
+	if cache.Len() != 0 {
+		t.Errorf("stale result of invalidated index was cached")
+	}
+	_, _ = cache.fetch("tcp:localhost:9312", &q, query)
+	_, _ = cache.fetch("tcp:localhost:9312", &q, query)
+	if calls != 2 {
+		t.Errorf("expected result cached after invalidation, got %d calls", calls)
+	}
+}
+
+func TestResultCache_panic(t *testing.T) {
+	cache := NewResultCache(0, 0)
+	q := NewSearch("query", "lj", "")
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _ = cache.fetch("tcp:localhost:9312", &q, func() (*QueryResult, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waiter := make(chan error)
+	go func() {
+		_, err := cache.fetch("tcp:localhost:9312", &q, func() (*QueryResult, error) {
+			return &QueryResult{}, nil
+		})
+		waiter <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-waiter:
+		if err == nil {
+			t.Errorf("expected error for waiter of panicked query")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("waiter of panicked query hangs")
+	}
+}
+
+func TestClient_SetCache(t *testing.T) {
+	cl := NewClient()
+	cl.SetCache(NewResultCache(time.Minute, 100))
+
+	q := NewSearch("query", "lj", "")
+	for i := 0; i < 2; i++ {
+		foo, err := cl.RunQuery(q)
+		if err != nil {
+			fmt.Println(err.Error())
+		} else {
+			fmt.Println(foo)
+		}
+	}
+}
@@ -16,7 +16,7 @@ NeedDocs
 
 NeedDocs require to provide numbers of matched documents. It is either order numbers from the set of provided documents,
 or DocIDs, if documents are JSON and you pointed necessary field which contains DocID. (NOTE: json PQ calls are not yet
-implemented via API, it will be done later).
+implemented via API, use CallPQDocs for json documents).
 
 NeedQuery
 
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"syscall"
 	"time"
 )
 
@@ -18,6 +20,8 @@ type Client struct {
 	buf                  apibuf
 	timeout              time.Duration
 	maxAlloc             int
+	validate             bool
+	cache                *ResultCache
 }
 
 // NewClient creates default connector, which points to 'localhost:9312', has zero timeout and 8M maxalloc.
@@ -32,6 +36,8 @@ func NewClient() Client {
 		nil,
 		0,
 		8 * 1024 * 1024,
+		false,
+		nil,
 	}
 }
 
@@ -61,6 +67,30 @@ func (cl *Client) failclose(err error) error {
 	return err
 }
 
+// brokenConnection tells whether persistent connection can't be used after the request failed with `err`. It is so
+// for any error, except the one daemon reported for sphinxql statement.
+func brokenConnection(err error) bool {
+	if err == nil {
+		return false
+	}
+	_, ok := err.(sqlError)
+	return !ok
+}
+
+// networkError tells whether `err` is failure of the network (timeout, reset or closed connection), so the request
+// may succeed if sent again over new connection
+func networkError(err error) bool {
+	switch e := err.(type) {
+	case net.Error:
+		return true
+	case *os.SyscallError:
+		return networkError(e.Err)
+	case syscall.Errno:
+		return e == syscall.ECONNRESET || e == syscall.EPIPE
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
 func (client *Client) eof() bool {
 
 	if !client.connected {
@@ -2,6 +2,9 @@ package manticore
 
 import (
 	"fmt"
+	"io"
+	"net"
+	"sync"
 	"testing"
 )
 
@@ -85,4 +88,87 @@ func ExampleClient_SetServer_tcpsocket() {
 	// 9999
 }
 
+// fakeDaemon is searchd on localhost, which answers OK to every sphinxql statement. Every accepted connection is
+// also passed to `conns`, so the test may break it from the server side.
+type fakeDaemon struct {
+	net.Listener
+	conns chan net.Conn
 
+	mu    sync.Mutex
+	stmts []string
+}
+
+func newFakeDaemon(t *testing.T) *fakeDaemon {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeDaemon{Listener: ln, conns: make(chan net.Conn, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			d.conns <- conn
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+// client returns client set to the daemon
+func (d *fakeDaemon) client() Client {
+	cl := NewClient()
+	cl.SetServer("127.0.0.1", uint16(d.Addr().(*net.TCPAddr).Port))
+	return cl
+}
+
+// statements returns sphinxql statements received so far
+func (d *fakeDaemon) statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.stmts...)
+}
+
+func (d *fakeDaemon) serve(conn net.Conn) {
+	defer conn.Close()
+	handshake := make([]byte, 4)
+	if _, err := io.ReadFull(conn, handshake); err != nil {
+		return
+	}
+	version := apibuf(make([]byte, 0, 4))
+	version.putUint(cphinxSearchdProto)
+	if _, err := conn.Write(version); err != nil {
+		return
+	}
+	for {
+		head := apibuf(make([]byte, 8))
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		command := eSearchdcommand(head.getWord())
+		_ = head.getWord()
+		body := apibuf(make([]byte, head.getInt()))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		if command != commandSphinxql {
+			continue // persist has no answer
+		}
+		d.mu.Lock()
+		d.stmts = append(d.stmts, body.getString())
+		d.mu.Unlock()
+
+		// mysql OK packet: 1 row affected, no last id, status and warnings
+		ok := []byte{7, 0, 0, 1, byte(packetOk), 1, 0, 0, 0, 0, 0}
+		answer := apibuf(make([]byte, 0, 8+len(ok)))
+		answer.putWord(uint16(StatusOk))
+		answer.putWord(uint16(searchdcommandv[command]))
+		answer.putUint(uint32(len(ok)))
+		answer.putBytes(ok)
+		if _, err := conn.Write(answer); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// excerptsChunk is a range of documents which is sent in one excerpts request
+type excerptsChunk struct {
+	first, count int
+}
+
+// ExcerptsChunkError is an error happened while building snippets for one chunk of documents.
+// `First` and `Count` define the range of documents in the chunk.
+type ExcerptsChunkError struct {
+	First, Count int
+	Err          error
+}
+
+// ExcerptsBatchErrors is returned by BuildExcerptsBatch() if one or more chunks failed.
+type ExcerptsBatchErrors []ExcerptsChunkError
+
+func (e ExcerptsBatchErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = fmt.Sprintf("docs %d..%d: %v", err.First, err.First+err.Count-1, err.Err)
+	}
+	return strings.Join(lines, "; ")
+}
+
+// excerptsOverhead estimates size of excerpts request without documents
+func excerptsOverhead(opts *SnippetOptions, index, words string) int {
+	strs := []string{index, words, opts.BeforeMatch, opts.AfterMatch, opts.ChunkSeparator, opts.HtmlStripMode,
+		opts.PassageBoundary}
+	size := 64 // header, mode, flags, numeric options and num of docs
+	for _, str := range strs {
+		size += 4 + len(str)
+	}
+	return size
+}
+
+// splitExcerptsDocs splits docs into subsequent chunks, each of which fits into `budget` bytes (including `overhead`).
+// Document which doesn't fit alone goes into separate chunk.
+func splitExcerptsDocs(docs []string, overhead, budget int) []excerptsChunk {
+	var chunks []excerptsChunk
+	chunk, size := excerptsChunk{0, 0}, overhead
+	for i, doc := range docs {
+		docsize := 4 + len(doc)
+		if chunk.count > 0 && size+docsize > budget {
+			chunks = append(chunks, chunk)
+			chunk, size = excerptsChunk{i, 0}, overhead
+		}
+		chunk.count++
+		size += docsize
+	}
+	if chunk.count > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// runExcerptsChunks processes chunks by `workers` goroutines. Each worker gets chunks from the common queue, and calls
+// `build` with it's number, so it may keep own connection.
+func runExcerptsChunks(chunks []excerptsChunk, workers int, build func(worker int, chunk excerptsChunk) ([]string, error),
+	result []string) ExcerptsBatchErrors {
+
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	queue := make(chan int, len(chunks))
+	for i := range chunks {
+		queue <- i
+	}
+	close(queue)
+
+	errs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range queue {
+				chunk := chunks[i]
+				snippets, err := build(w, chunk)
+				if err == nil && len(snippets) != chunk.count {
+					err = fmt.Errorf("got %d snippets for %d documents", len(snippets), chunk.count)
+				}
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				copy(result[chunk.first:], snippets)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var failed ExcerptsBatchErrors
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, ExcerptsChunkError{chunks[i].first, chunks[i].count, err})
+		}
+	}
+	return failed
+}
+
+// clone creates new client with the same settings, but without connection.
+func (cl *Client) clone() Client {
+	worker := NewClient()
+	worker.host, worker.dialmethod, worker.port = cl.host, cl.dialmethod, cl.port
+	worker.timeout, worker.maxAlloc = cl.timeout, cl.maxAlloc
+	return worker
+}
+
+/*
+BuildExcerptsBatch works like BuildExcerpts, but splits documents into several requests, each of which is not bigger
+than `budget` bytes, and runs them in parallel by `workers` goroutines. Use it for many or long documents, which
+don't fit into max_packet_size of the daemon, or take too long to process in one request.
+
+Each worker uses own persistent connection to the daemon (with the same server and timeout settings as the client),
+which is closed when all the chunks are processed. The client itself is not used for requests, so it's
+persistent connection (if any) stays untouched.
+
+Snippets are returned in the order of `docs`. If some chunks failed, ExcerptsBatchErrors is returned together with
+snippets, where snippets of failed chunks are empty strings. A document which doesn't fit into the budget alone is
+sent in separate request.
+
+Usage example:
+
+  snippets, err := cl.BuildExcerptsBatch(docs, "lj", "hello world", 4*1024*1024, 4)
+  if errs, ok := err.(ExcerptsBatchErrors); ok {
+    for _, e := range errs {
+      fmt.Println("failed docs from", e.First, ":", e.Err)
+    }
+  }
+*/
+func (cl *Client) BuildExcerptsBatch(docs []string, index, words string, budget, workers int,
+	opts ...SnippetOptions) ([]string, error) {
+
+	var popts *SnippetOptions
+	if len(opts) > 0 {
+		popts = &opts[0]
+	} else {
+		popts = NewSnippetOptions()
+	}
+
+	if len(docs) == 0 {
+		return nil, errors.New("invalid arguments (docs must not be empty)")
+	}
+
+	if index == "" {
+		return nil, errors.New("invalid arguments (index must not be empty)")
+	}
+
+	if words == "" {
+		return nil, errors.New("invalid arguments (words must not be empty)")
+	}
+
+	if workers <= 0 {
+		return nil, errors.New("invalid arguments (workers must be positive)")
+	}
+
+	overhead := excerptsOverhead(popts, index, words)
+	if budget <= overhead {
+		return nil, fmt.Errorf("invalid arguments (budget must be greater than %d bytes)", overhead)
+	}
+
+	chunks := splitExcerptsDocs(docs, overhead, budget)
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	clients := make([]Client, workers)
+	for w := range clients {
+		clients[w] = cl.clone()
+	}
+	defer func() {
+		for w := range clients {
+			if clients[w].connected {
+				_, _ = clients[w].Close()
+			}
+		}
+	}()
+
+	result := make([]string, len(docs))
+	failed := runExcerptsChunks(chunks, workers, func(w int, chunk excerptsChunk) ([]string, error) {
+		worker := &clients[w]
+		if !worker.connected {
+			if _, err := worker.Open(); err != nil {
+				return nil, err
+			}
+		}
+		return worker.BuildExcerpts(docs[chunk.first:chunk.first+chunk.count], index, words, *popts)
+	}, result)
+
+	if failed != nil {
+		return result, failed
+	}
+	return result, nil
+}
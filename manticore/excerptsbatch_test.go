@@ -0,0 +1,79 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSplitExcerptsDocs(t *testing.T) {
+
+	docs := []string{"aaaa", "bbbb", "cccc", strings.Repeat("x", 100), "dd"}
+	chunks := splitExcerptsDocs(docs, 10, 26)
+	expected := []excerptsChunk{{0, 2}, {2, 1}, {3, 1}, {4, 1}}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("unexpected chunks %v", chunks)
+	}
+
+	chunks = splitExcerptsDocs(docs, 10, 1000)
+	if !reflect.DeepEqual(chunks, []excerptsChunk{{0, 5}}) {
+		t.Errorf("expected one chunk, got %v", chunks)
+	}
+}
+
+func TestRunExcerptsChunks(t *testing.T) {
+
+	docs := make([]string, 100)
+	for i := range docs {
+		docs[i] = fmt.Sprintf("doc%d", i)
+	}
+	chunks := splitExcerptsDocs(docs, 0, 50)
+
+	var calls int32
+	result := make([]string, len(docs))
+	failed := runExcerptsChunks(chunks, 4, func(w int, chunk excerptsChunk) ([]string, error) {
+		atomic.AddInt32(&calls, 1)
+		if chunk.first == 0 {
+			return nil, errors.New("daemon is busy")
+		}
+		snippets := make([]string, chunk.count)
+		for i := range snippets {
+			snippets[i] = "<b>" + docs[chunk.first+i] + "</b>"
+		}
+		return snippets, nil
+	}, result)
+
+	if int(calls) != len(chunks) {
+		t.Errorf("expected %d calls, got %d", len(chunks), calls)
+	}
+	if len(failed) != 1 || failed[0].First != 0 || failed[0].Count != chunks[0].count {
+		t.Fatalf("unexpected errors %v", failed)
+	}
+	if failed.Error() != fmt.Sprintf("docs 0..%d: daemon is busy", chunks[0].count-1) {
+		t.Errorf("unexpected error text %s", failed.Error())
+	}
+	for i, snippet := range result {
+		if i < chunks[0].count {
+			if snippet != "" {
+				t.Errorf("expected empty snippet for failed doc %d", i)
+			}
+		} else if snippet != "<b>"+docs[i]+"</b>" {
+			t.Errorf("doc %d: unexpected snippet %s", i, snippet)
+		}
+	}
+}
+
+func TestClient_BuildExcerptsBatch(t *testing.T) {
+
+	cl := NewClient()
+	docs := []string{"this is my test text to be highlighted", "another test text", "and one more test"}
+	snippets, err := cl.BuildExcerptsBatch(docs, "lj", "test text", 200, 2)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(snippets)
+	}
+}
@@ -0,0 +1,277 @@
+package manticore
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormat is the format of output of MatchWriter and export functions.
+type ExportFormat int
+
+const (
+	ExportNDJSON ExportFormat = iota // one JSON object per line
+	ExportCSV                        // comma-separated values with header row
+)
+
+/*
+MatchWriter serializes matches one by one into NDJSON or CSV stream. Every match is written as soon as it is passed,
+so it may be used to dump huge results, say, batch by batch from Scroller, without keeping them in memory:
+
+  sc, _ := cl.Scroll(q)
+  var mw *MatchWriter
+  for {
+    batch, err := sc.NextBatch()
+    if err != nil || len(batch) == 0 {
+      break
+    }
+    if mw == nil {
+      mw = NewMatchWriter(os.Stdout, ExportCSV, sc.Attrs())
+    }
+    for _, m := range batch {
+      mw.WriteMatch(m)
+    }
+  }
+  if mw != nil {
+    mw.Flush()
+  }
+
+Every record has 'id' and 'weight', followed by the attributes. JSON attributes are embedded as is into NDJSON,
+MVA become arrays, timestamps are written in RFC3339 format (UTC). In CSV, MVA values are joined with commas,
+and JSON attributes are written as text.
+*/
+type MatchWriter struct {
+	format ExportFormat
+	attrs  []ColumnInfo
+	buf    *bufio.Writer
+	csv    *csv.Writer
+	header bool
+}
+
+// NewMatchWriter creates MatchWriter which writes matches with attributes `attrs` into `w` in given format.
+func NewMatchWriter(w io.Writer, format ExportFormat, attrs []ColumnInfo) *MatchWriter {
+	mw := &MatchWriter{format: format, attrs: attrs}
+	if format == ExportCSV {
+		mw.csv = csv.NewWriter(w)
+	} else {
+		mw.buf = bufio.NewWriter(w)
+	}
+	return mw
+}
+
+// WriteMatch writes one match. For CSV, header row is written before the first match.
+func (mw *MatchWriter) WriteMatch(match Match) error {
+	if len(match.Attrs) != len(mw.attrs) {
+		return fmt.Errorf("match has %d attributes, schema has %d", len(match.Attrs), len(mw.attrs))
+	}
+	if mw.format == ExportCSV {
+		if !mw.header {
+			if err := mw.writeHeader(); err != nil {
+				return err
+			}
+		}
+		record := make([]string, 0, len(mw.attrs)+2)
+		record = append(record, strconv.FormatUint(uint64(match.DocID), 10), strconv.Itoa(match.Weight))
+		for _, val := range match.Attrs {
+			record = append(record, exportText(val))
+		}
+		return mw.csv.Write(record)
+	}
+
+	mw.buf.WriteString(`{"id":`)
+	mw.buf.WriteString(strconv.FormatUint(uint64(match.DocID), 10))
+	mw.buf.WriteString(`,"weight":`)
+	mw.buf.WriteString(strconv.Itoa(match.Weight))
+	for i, col := range mw.attrs {
+		if err := writeJSONField(mw.buf, col.Name, match.Attrs[i]); err != nil {
+			return err
+		}
+	}
+	_, err := mw.buf.WriteString("}\n")
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer. For CSV, it also writes header, if no match was written.
+func (mw *MatchWriter) Flush() error {
+	if mw.format == ExportCSV {
+		if !mw.header {
+			if err := mw.writeHeader(); err != nil {
+				return err
+			}
+		}
+		mw.csv.Flush()
+		return mw.csv.Error()
+	}
+	return mw.buf.Flush()
+}
+
+func (mw *MatchWriter) writeHeader() error {
+	mw.header = true
+	header := make([]string, 0, len(mw.attrs)+2)
+	header = append(header, "id", "weight")
+	for _, col := range mw.attrs {
+		header = append(header, col.Name)
+	}
+	return mw.csv.Write(header)
+}
+
+// writeJSONField appends `,"name":value` to NDJSON record
+func writeJSONField(w *bufio.Writer, name string, val interface{}) error {
+	key, err := json.Marshal(name)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(exportJSON(val))
+	if err != nil {
+		return err
+	}
+	w.WriteByte(',')
+	w.Write(key)
+	w.WriteByte(':')
+	_, err = w.Write(value)
+	return err
+}
+
+// exportJSON converts attribute value into one suitable for json.Marshal
+func exportJSON(val interface{}) interface{} {
+	switch val := val.(type) {
+	case JsonOrStr:
+		if val.IsJson && json.Valid([]byte(val.Val)) {
+			return json.RawMessage(val.Val)
+		}
+		return val.Val
+	case []byte:
+		if json.Valid(val) {
+			return json.RawMessage(val)
+		}
+		return string(val)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339)
+	case uint32, uint64, int32, int64, int, float32, float64, string, bool, nil, []uint32, []uint64:
+		return val
+	}
+	return fmt.Sprint(val)
+}
+
+// exportText converts attribute value into text of CSV cell
+func exportText(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return ""
+	case JsonOrStr:
+		return val.Val
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	case []uint32:
+		items := make([]string, len(val))
+		for i, v := range val {
+			items[i] = strconv.FormatUint(uint64(v), 10)
+		}
+		return strings.Join(items, ",")
+	case []uint64:
+		items := make([]string, len(val))
+		for i, v := range val {
+			items[i] = strconv.FormatUint(v, 10)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(val)
+}
+
+func (res *QueryResult) export(w io.Writer, format ExportFormat) error {
+	mw := NewMatchWriter(w, format, res.Attrs)
+	for _, match := range res.Matches {
+		if err := mw.WriteMatch(match); err != nil {
+			return err
+		}
+	}
+	return mw.Flush()
+}
+
+// WriteNDJSON writes matches of the result into `w`, one JSON object per line. See MatchWriter for details.
+func (res *QueryResult) WriteNDJSON(w io.Writer) error {
+	return res.export(w, ExportNDJSON)
+}
+
+// WriteCSV writes matches of the result into `w` as CSV, with header row. See MatchWriter for details.
+func (res *QueryResult) WriteCSV(w io.Writer) error {
+	return res.export(w, ExportCSV)
+}
+
+func (r *Sqlresult) checkExport() error {
+	if r.ErrorCode != 0 {
+		return fmt.Errorf("ERROR %d %v", r.ErrorCode, r.Msg)
+	}
+	if r.Schema == nil {
+		return errors.New("resultset has no rows")
+	}
+	return nil
+}
+
+// WriteNDJSON writes rows of the resultset into `w`, one JSON object per line, with keys named by the columns.
+// Returns error for resultsets without rows schema (like answer to INSERT), or resultsets with error.
+func (r *Sqlresult) WriteNDJSON(w io.Writer) error {
+	if err := r.checkExport(); err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+	for _, row := range r.Rows {
+		buf.WriteByte('{')
+		for i, col := range r.Schema {
+			key, err := json.Marshal(col.Name)
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(exportJSON(row[i]))
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		if _, err := buf.WriteString("}\n"); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// WriteCSV writes rows of the resultset into `w` as CSV, with header row of column names.
+// Returns error for resultsets without rows schema (like answer to INSERT), or resultsets with error.
+func (r *Sqlresult) WriteCSV(w io.Writer) error {
+	if err := r.checkExport(); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	record := make([]string, len(r.Schema))
+	for i, col := range r.Schema {
+		record[i] = col.Name
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for _, row := range r.Rows {
+		for i := range r.Schema {
+			record[i] = exportText(row[i])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,86 @@
+package manticore
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func testExportResult() *QueryResult {
+	return &QueryResult{
+		Attrs: []ColumnInfo{{"title", AttrString}, {"price", AttrFloat}, {"tags", AttrUint32set},
+			{"published", AttrTimestamp}, {"j", AttrString}},
+		Matches: []Match{
+			{1, 2500, []interface{}{JsonOrStr{false, `say "hi", world`}, float32(1.5), []uint32{1, 2},
+				time.Unix(1500000000, 0), JsonOrStr{true, `{"a":1}`}}},
+			{2, 1500, []interface{}{JsonOrStr{false, "plain"}, float32(2), []uint32{}, time.Unix(0, 0), nil}},
+		},
+	}
+}
+
+func TestQueryResult_WriteNDJSON(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := testExportResult().WriteNDJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"id":1,"weight":2500,"title":"say \"hi\", world","price":1.5,"tags":[1,2],"published":"2017-07-14T02:40:00Z","j":{"a":1}}
+{"id":2,"weight":1500,"title":"plain","price":2,"tags":[],"published":"1970-01-01T00:00:00Z","j":null}
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestQueryResult_WriteCSV(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := testExportResult().WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `id,weight,title,price,tags,published,j
+1,2500,"say ""hi"", world",1.5,"1,2",2017-07-14T02:40:00Z,"{""a"":1}"
+2,1500,plain,2,,1970-01-01T00:00:00Z,
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	mw := NewMatchWriter(&buf, ExportCSV, []ColumnInfo{{"gid", AttrInteger}})
+	if err := mw.WriteMatch(Match{1, 1, nil}); err == nil {
+		t.Error("expected error for match not matching schema")
+	}
+	if err := mw.Flush(); err != nil || buf.String() != "id,weight,gid\n" {
+		t.Errorf("expected only header for empty result, got %q (%v)", buf.String(), err)
+	}
+}
+
+func TestSqlresult_Write(t *testing.T) {
+
+	rs := Sqlresult{
+		Schema: SqlSchema{{"id", 0, colLonglong, true}, {"title", 0, colString, false}, {"n", 0, colLong, false}},
+		Rows:   SqlResultset{{uint64(1), "hello", int32(-5)}, {uint64(2), nil, int32(7)}},
+	}
+	var buf bytes.Buffer
+	if err := rs.WriteNDJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\"id\":1,\"title\":\"hello\",\"n\":-5}\n{\"id\":2,\"title\":null,\"n\":7}\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected NDJSON:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := rs.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "id,title,n\n1,hello,-5\n2,,7\n" {
+		t.Errorf("unexpected CSV:\n%s", buf.String())
+	}
+
+	rs = Sqlresult{ErrorCode: 1064, Msg: "syntax error"}
+	if err := rs.WriteCSV(&buf); err == nil {
+		t.Error("expected error for error resultset")
+	}
+}
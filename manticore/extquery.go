@@ -0,0 +1,882 @@
+package manticore
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+QueryNode is a node of the parsed extended query syntax tree, as returned by ParseQuery().
+
+Concrete node types are:
+
+QueryTerm
+
+QueryTerm is a single keyword, with optional exact form (=word), field start (^word), field end (word$) and boost (word^1.5)
+modifiers.
+
+QueryPhrase
+
+QueryPhrase is a quoted sequence of terms. Depending on Mode it is an exact phrase "a b c", proximity "a b c"~N or quorum
+"a b c"/N match.
+
+QueryAnd
+
+QueryAnd is a sequence of nodes which all must match (space-separated in the query).
+
+QueryOr
+
+QueryOr is a list of alternatives (separated by '|' in the query).
+
+QueryNot
+
+QueryNot negates its operand (-word or !word).
+
+QueryOperator
+
+QueryOperator is a binary operator between two nodes: NEAR/N, NOTNEAR/N, SENTENCE, PARAGRAPH, MAYBE and strict order '<<'.
+
+QueryField
+
+QueryField limits its operand to the given fields: @title, @(title,body), @!title, @* and @title[50].
+
+QueryZone
+
+QueryZone limits its operand to the given zones: ZONE:(h1,h2) or ZONESPAN:(h1).
+
+Precedence of operators from the tightest to the loosest is: negation, OR, binary keyword operators, AND. Field and zone limits
+apply to everything which follows them in the current group (till the closing bracket, or till the next limit).
+
+Any node may be printed back to the query string by calling it's String() method.
+*/
+type QueryNode interface {
+	fmt.Stringer
+	queryNode()
+}
+
+// QueryTerm is a single keyword of extended query
+type QueryTerm struct {
+	Word       string  // keyword itself, unescaped. May contain wildcards as '*', '?' or '%'
+	Exact      bool    // exact form modifier, '=word'
+	FieldStart bool    // field start modifier, '^word'
+	FieldEnd   bool    // field end modifier, 'word$'
+	Boost      float64 // keyword IDF boost, 'word^1.5'. Zero means no boost
+}
+
+// EPhraseMode determines kind of QueryPhrase node
+type EPhraseMode uint32
+
+const (
+	PhraseExact     EPhraseMode = iota // "a b c"
+	PhraseProximity                    // "a b c"~N
+	PhraseQuorum                       // "a b c"/N
+)
+
+// QueryPhrase is a quoted sequence of terms
+type QueryPhrase struct {
+	Terms     []*QueryTerm
+	Mode      EPhraseMode
+	Distance  int     // proximity distance for PhraseProximity
+	Threshold float64 // quorum threshold for PhraseQuorum. Either absolute number of words, either fraction (0.5)
+}
+
+// QueryAnd is a sequence of nodes which all must match
+type QueryAnd struct {
+	Children []QueryNode
+}
+
+// QueryOr is a list of alternatives
+type QueryOr struct {
+	Children []QueryNode
+}
+
+// QueryNot negates its operand
+type QueryNot struct {
+	Child QueryNode
+}
+
+// QueryOperator is a binary operator, like NEAR/N. Op is one of "NEAR", "NOTNEAR", "SENTENCE", "PARAGRAPH", "MAYBE", "<<".
+type QueryOperator struct {
+	Op          string
+	Distance    int // distance for NEAR and NOTNEAR
+	Left, Right QueryNode
+}
+
+// QueryField limits operand to the set of fields
+type QueryField struct {
+	Fields []string // list of fields. Empty for '@*'
+	Ignore bool     // '@!' - search in all fields except given
+	Limit  int      // field position limit, '@title[50]'. Zero means no limit
+	Child  QueryNode
+}
+
+// QueryZone limits operand to the set of zones
+type QueryZone struct {
+	Zones []string
+	Span  bool // ZONESPAN instead of ZONE
+	Child QueryNode
+}
+
+func (*QueryTerm) queryNode()     {}
+func (*QueryPhrase) queryNode()   {}
+func (*QueryAnd) queryNode()      {}
+func (*QueryOr) queryNode()       {}
+func (*QueryNot) queryNode()      {}
+func (*QueryOperator) queryNode() {}
+func (*QueryField) queryNode()    {}
+func (*QueryZone) queryNode()     {}
+
+// QueryParseError is returned by ParseQuery() and points to the place in the query where problem was detected.
+type QueryParseError struct {
+	Pos int    // byte offset in the query
+	Msg string // description of the problem
+}
+
+func (e *QueryParseError) Error() string {
+	return fmt.Sprintf("query parse error at %d: %s", e.Pos, e.Msg)
+}
+
+/*
+ParseQuery parses query in extended syntax (as used with MatchExtended) into the tree of QueryNode.
+Returns nil and no error for a query without any terms (full-scan).
+
+On invalid input returns *QueryParseError with byte offset of the problem.
+
+Usage example:
+
+  node, err := ParseQuery(`@title hello | "big world"~3`)
+  if err != nil {
+    fmt.Println(err.Error())
+  }
+  fmt.Println(node)
+*/
+func ParseQuery(query string) (QueryNode, error) {
+	p := queryParser{src: query}
+	node, err := p.parseSequence()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return nil, p.fail("unexpected '%c'", p.src[p.pos])
+	}
+	return node, nil
+}
+
+type queryParser struct {
+	src string
+	pos int
+}
+
+func (p *queryParser) fail(format string, args ...interface{}) error {
+	return &QueryParseError{p.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *queryParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *queryParser) skipSpaces() {
+	for !p.eof() && isQuerySpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.src[p.pos:], prefix)
+}
+
+func isQuerySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// chars which always terminate a keyword
+func isQueryDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '|', '"', '~', '/', '<', '@', '$':
+		return true
+	}
+	return isQuerySpace(c)
+}
+
+func isFieldNameChar(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// keyword operator at current position, like NEAR/3 or SENTENCE. Must be followed by delimiter to be recognized.
+func (p *queryParser) keywordAt(kw string) bool {
+	if !p.hasPrefix(kw) {
+		return false
+	}
+	end := p.pos + len(kw)
+	return end == len(p.src) || isQueryDelimiter(p.src[end]) || (kw[len(kw)-1] == '/' || kw[len(kw)-1] == ':')
+}
+
+// parseSequence parses implicit AND of items till the end of group. Field and zone limits wrap rest of the group.
+func (p *queryParser) parseSequence() (QueryNode, error) {
+	var items []QueryNode
+	for {
+		p.skipSpaces()
+		if p.eof() || p.peek() == ')' {
+			break
+		}
+
+		var limit func(QueryNode) QueryNode
+		var err error
+		switch {
+		case p.peek() == '@':
+			limit, err = p.parseFieldSpec()
+		case p.keywordAt("ZONE:"), p.keywordAt("ZONESPAN:"):
+			limit, err = p.parseZoneSpec()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if limit != nil {
+			start := p.pos
+			rest, err := p.parseSequence()
+			if err != nil {
+				return nil, err
+			}
+			if rest == nil {
+				p.pos = start
+				return nil, p.fail("missing operand after field or zone limit")
+			}
+			items = append(items, limit(rest))
+			break
+		}
+
+		item, err := p.parseOperators()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	switch len(items) {
+	case 0:
+		return nil, nil
+	case 1:
+		return items[0], nil
+	}
+	return &QueryAnd{items}, nil
+}
+
+// parseOperators parses chain of binary keyword operators, left-associative
+func (p *queryParser) parseOperators() (QueryNode, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		op := QueryOperator{}
+		switch {
+		case p.hasPrefix("<<"):
+			op.Op = "<<"
+			p.pos += 2
+		case p.keywordAt("NEAR/"), p.keywordAt("NOTNEAR/"):
+			op.Op = p.src[p.pos : p.pos+strings.IndexByte(p.src[p.pos:], '/')]
+			p.pos += len(op.Op) + 1
+			op.Distance, err = p.parseInt()
+			if err != nil {
+				return nil, err
+			}
+		case p.keywordAt("SENTENCE"), p.keywordAt("PARAGRAPH"), p.keywordAt("MAYBE"):
+			for _, kw := range []string{"SENTENCE", "PARAGRAPH", "MAYBE"} {
+				if p.hasPrefix(kw) {
+					op.Op = kw
+				}
+			}
+			p.pos += len(op.Op)
+		default:
+			return left, nil
+		}
+		p.skipSpaces()
+		if p.eof() || p.peek() == ')' {
+			return nil, p.fail("missing right operand of %s", op.Op)
+		}
+		op.Left = left
+		op.Right, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = &op
+	}
+}
+
+func (p *queryParser) parseOr() (QueryNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []QueryNode{first}
+	for {
+		p.skipSpaces()
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+		p.skipSpaces()
+		if p.eof() || p.peek() == ')' || p.peek() == '|' {
+			return nil, p.fail("missing operand of '|'")
+		}
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &QueryOr{children}, nil
+}
+
+func (p *queryParser) parseUnary() (QueryNode, error) {
+	p.skipSpaces()
+	if c := p.peek(); c == '-' || c == '!' {
+		p.pos++
+		if p.eof() || isQuerySpace(p.peek()) || p.peek() == ')' {
+			p.pos--
+			return nil, p.fail("missing operand of '%c'", c)
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &QueryNot{child}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (QueryNode, error) {
+	switch p.peek() {
+	case '(':
+		open := p.pos
+		p.pos++
+		node, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			p.pos = open
+			return nil, p.fail("unbalanced '('")
+		}
+		if node == nil {
+			p.pos = open
+			return nil, p.fail("empty group")
+		}
+		p.pos++
+		return node, nil
+	case '"':
+		return p.parsePhrase()
+	case ')', '|', '~', '/', '<', '@', '$':
+		return nil, p.fail("unexpected '%c'", p.peek())
+	}
+	return p.parseTerm()
+}
+
+func (p *queryParser) parsePhrase() (QueryNode, error) {
+	open := p.pos
+	p.pos++
+	phrase := QueryPhrase{}
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			p.pos = open
+			return nil, p.fail("unterminated '\"'")
+		}
+		if p.peek() == '"' {
+			p.pos++
+			break
+		}
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		phrase.Terms = append(phrase.Terms, term)
+	}
+	if len(phrase.Terms) == 0 {
+		p.pos = open
+		return nil, p.fail("empty phrase")
+	}
+
+	var err error
+	switch p.peek() {
+	case '~':
+		p.pos++
+		phrase.Mode = PhraseProximity
+		phrase.Distance, err = p.parseInt()
+	case '/':
+		p.pos++
+		phrase.Mode = PhraseQuorum
+		phrase.Threshold, err = p.parseNumber()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &phrase, nil
+}
+
+func (p *queryParser) parseTerm() (*QueryTerm, error) {
+	start := p.pos
+	term := QueryTerm{}
+	for ; p.peek() == '=' || p.peek() == '^'; p.pos++ {
+		if p.peek() == '=' {
+			term.Exact = true
+		} else {
+			term.FieldStart = true
+		}
+	}
+
+	var word bytes.Buffer
+	for !p.eof() {
+		c := p.peek()
+		if c == '\\' {
+			p.pos++
+			if p.eof() {
+				return nil, p.fail("dangling escape")
+			}
+			word.WriteByte(p.peek())
+			p.pos++
+			continue
+		}
+		if isQueryDelimiter(c) || c == '^' {
+			break
+		}
+		word.WriteByte(c)
+		p.pos++
+	}
+	if word.Len() == 0 {
+		if p.eof() {
+			p.pos = start
+			return nil, p.fail("missing keyword")
+		}
+		return nil, p.fail("unexpected '%c'", p.peek())
+	}
+	term.Word = word.String()
+
+	if p.peek() == '^' {
+		p.pos++
+		boost, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		term.Boost = boost
+	}
+	if p.peek() == '$' {
+		p.pos++
+		term.FieldEnd = true
+	}
+	return &term, nil
+}
+
+func (p *queryParser) scanNumber() string {
+	start := p.pos
+	for !p.eof() && (p.peek() >= '0' && p.peek() <= '9' || p.peek() == '.') {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *queryParser) parseInt() (int, error) {
+	start := p.pos
+	val, err := strconv.Atoi(p.scanNumber())
+	if err != nil || val < 0 {
+		p.pos = start
+		return 0, p.fail("expected non-negative integer")
+	}
+	return val, nil
+}
+
+func (p *queryParser) parseNumber() (float64, error) {
+	start := p.pos
+	val, err := strconv.ParseFloat(p.scanNumber(), 64)
+	if err != nil {
+		p.pos = start
+		return 0, p.fail("expected number")
+	}
+	return val, nil
+}
+
+func (p *queryParser) parseNameList() ([]string, error) {
+	if p.peek() != '(' {
+		return nil, p.fail("expected '('")
+	}
+	p.pos++
+	var names []string
+	for {
+		p.skipSpaces()
+		start := p.pos
+		for !p.eof() && isFieldNameChar(p.peek()) {
+			p.pos++
+		}
+		if start == p.pos {
+			return nil, p.fail("expected name")
+		}
+		names = append(names, p.src[start:p.pos])
+		p.skipSpaces()
+		switch p.peek() {
+		case ',':
+			p.pos++
+			continue
+		case ')':
+			p.pos++
+			return names, nil
+		}
+		return nil, p.fail("expected ',' or ')'")
+	}
+}
+
+func (p *queryParser) parseFieldSpec() (func(QueryNode) QueryNode, error) {
+	p.pos++ // '@'
+	field := QueryField{}
+	if p.peek() == '!' {
+		field.Ignore = true
+		p.pos++
+	}
+
+	var err error
+	switch {
+	case p.peek() == '*' && !field.Ignore:
+		p.pos++
+	case p.peek() == '(':
+		field.Fields, err = p.parseNameList()
+	default:
+		start := p.pos
+		for !p.eof() && isFieldNameChar(p.peek()) {
+			p.pos++
+		}
+		if start == p.pos {
+			return nil, p.fail("expected field name")
+		}
+		field.Fields = []string{p.src[start:p.pos]}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() == '[' {
+		p.pos++
+		field.Limit, err = p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ']' {
+			return nil, p.fail("expected ']'")
+		}
+		p.pos++
+	}
+	return func(child QueryNode) QueryNode {
+		field.Child = child
+		return &field
+	}, nil
+}
+
+func (p *queryParser) parseZoneSpec() (func(QueryNode) QueryNode, error) {
+	zone := QueryZone{Span: p.hasPrefix("ZONESPAN:")}
+	if zone.Span {
+		p.pos += len("ZONESPAN:")
+	} else {
+		p.pos += len("ZONE:")
+	}
+	var err error
+	zone.Zones, err = p.parseNameList()
+	if err != nil {
+		return nil, err
+	}
+	return func(child QueryNode) QueryNode {
+		zone.Child = child
+		return &zone
+	}, nil
+}
+
+// precedence levels used for printing
+const (
+	precSequence = iota
+	precOperator
+	precOr
+	precUnary
+	precPrimary
+)
+
+func queryPrecedence(node QueryNode) int {
+	switch node.(type) {
+	case *QueryAnd, *QueryField, *QueryZone:
+		return precSequence
+	case *QueryOperator:
+		return precOperator
+	case *QueryOr:
+		return precOr
+	case *QueryNot:
+		return precUnary
+	}
+	return precPrimary
+}
+
+// print node, wrapping it into brackets if it binds looser than required
+func queryWrap(node QueryNode, prec int) string {
+	if queryPrecedence(node) < prec {
+		return "(" + node.String() + ")"
+	}
+	return node.String()
+}
+
+func escapeQueryWord(word string) string {
+	dest := make([]byte, 0, 2*len(word))
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		switch c {
+		case '\\', '(', ')', '|', '-', '!', '@', '~', '"', '&', '/', '^', '$', '=', '<', ' ', '\t', '\n', '\r':
+			dest = append(dest, '\\')
+		}
+		dest = append(dest, c)
+	}
+	return string(dest)
+}
+
+func formatQueryNumber(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// Stringer interface for QueryTerm type
+func (n *QueryTerm) String() string {
+	line := ""
+	if n.Exact {
+		line += "="
+	}
+	if n.FieldStart {
+		line += "^"
+	}
+	line += escapeQueryWord(n.Word)
+	if n.Boost != 0 {
+		line += "^" + formatQueryNumber(n.Boost)
+	}
+	if n.FieldEnd {
+		line += "$"
+	}
+	return line
+}
+
+// Stringer interface for QueryPhrase type
+func (n *QueryPhrase) String() string {
+	words := make([]string, len(n.Terms))
+	for i, term := range n.Terms {
+		words[i] = term.String()
+	}
+	line := `"` + strings.Join(words, " ") + `"`
+	switch n.Mode {
+	case PhraseProximity:
+		line += "~" + strconv.Itoa(n.Distance)
+	case PhraseQuorum:
+		line += "/" + formatQueryNumber(n.Threshold)
+	}
+	return line
+}
+
+// Stringer interface for QueryAnd type
+func (n *QueryAnd) String() string {
+	items := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		// nested sequence or limit in the middle would swallow following siblings, so they need brackets
+		if _, nested := child.(*QueryAnd); nested || i < len(n.Children)-1 {
+			items[i] = queryWrap(child, precOperator)
+		} else {
+			items[i] = child.String()
+		}
+	}
+	return strings.Join(items, " ")
+}
+
+// Stringer interface for QueryOr type
+func (n *QueryOr) String() string {
+	items := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		items[i] = queryWrap(child, precUnary)
+	}
+	return strings.Join(items, " | ")
+}
+
+// Stringer interface for QueryNot type
+func (n *QueryNot) String() string {
+	return "-" + queryWrap(n.Child, precPrimary)
+}
+
+// Stringer interface for QueryOperator type
+func (n *QueryOperator) String() string {
+	op := n.Op
+	if op == "NEAR" || op == "NOTNEAR" {
+		op += "/" + strconv.Itoa(n.Distance)
+	}
+	return queryWrap(n.Left, precOperator) + " " + op + " " + queryWrap(n.Right, precOr)
+}
+
+// Stringer interface for QueryField type
+func (n *QueryField) String() string {
+	line := "@"
+	if n.Ignore {
+		line += "!"
+	}
+	switch len(n.Fields) {
+	case 0:
+		line += "*"
+	case 1:
+		line += n.Fields[0]
+	default:
+		line += "(" + strings.Join(n.Fields, ",") + ")"
+	}
+	if n.Limit != 0 {
+		line += "[" + strconv.Itoa(n.Limit) + "]"
+	}
+	return line + " " + n.Child.String()
+}
+
+// Stringer interface for QueryZone type
+func (n *QueryZone) String() string {
+	line := "ZONE:("
+	if n.Span {
+		line = "ZONESPAN:("
+	}
+	return line + strings.Join(n.Zones, ",") + ") " + n.Child.String()
+}
+
+/*
+WalkQuery traverses query tree in depth-first order, calling `fn` for each node. If `fn` returns false, children of
+the node are not visited.
+
+For example, count all the keywords of the query:
+
+  terms := 0
+  WalkQuery(node, func(n QueryNode) bool {
+    switch n := n.(type) {
+    case *QueryTerm:
+      terms++
+    case *QueryPhrase:
+      terms += len(n.Terms)
+    }
+    return true
+  })
+*/
+func WalkQuery(node QueryNode, fn func(QueryNode) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *QueryPhrase:
+		for _, term := range n.Terms {
+			WalkQuery(term, fn)
+		}
+	case *QueryAnd:
+		for _, child := range n.Children {
+			WalkQuery(child, fn)
+		}
+	case *QueryOr:
+		for _, child := range n.Children {
+			WalkQuery(child, fn)
+		}
+	case *QueryNot:
+		WalkQuery(n.Child, fn)
+	case *QueryOperator:
+		WalkQuery(n.Left, fn)
+		WalkQuery(n.Right, fn)
+	case *QueryField:
+		WalkQuery(n.Child, fn)
+	case *QueryZone:
+		WalkQuery(n.Child, fn)
+	}
+}
+
+/*
+RewriteQuery transforms query tree bottom-up. `fn` is called for each node after it's children are already rewritten,
+and returned node replaces original one. Returning nil removes the node; parents which lost all their operands are
+removed as well, and AND/OR with the only operand left are collapsed into that operand. Terms of the phrases are
+rewritten by `fn` too, and must stay *QueryTerm (or nil).
+
+For example, strip all field limits and cap proximity distances:
+
+  node = RewriteQuery(node, func(n QueryNode) QueryNode {
+    switch n := n.(type) {
+    case *QueryField:
+      return n.Child
+    case *QueryPhrase:
+      if n.Mode == PhraseProximity && n.Distance > 10 {
+        n.Distance = 10
+      }
+    }
+    return n
+  })
+*/
+func RewriteQuery(node QueryNode, fn func(QueryNode) QueryNode) QueryNode {
+	if node == nil {
+		return nil
+	}
+	switch n := node.(type) {
+	case *QueryPhrase:
+		terms := n.Terms[:0]
+		for _, term := range n.Terms {
+			if res, ok := RewriteQuery(term, fn).(*QueryTerm); ok && res != nil {
+				terms = append(terms, res)
+			}
+		}
+		if len(terms) == 0 {
+			return nil
+		}
+		n.Terms = terms
+	case *QueryAnd:
+		n.Children = rewriteQueryList(n.Children, fn)
+		switch len(n.Children) {
+		case 0:
+			return nil
+		case 1:
+			return n.Children[0]
+		}
+	case *QueryOr:
+		n.Children = rewriteQueryList(n.Children, fn)
+		switch len(n.Children) {
+		case 0:
+			return nil
+		case 1:
+			return n.Children[0]
+		}
+	case *QueryNot:
+		if n.Child = RewriteQuery(n.Child, fn); n.Child == nil {
+			return nil
+		}
+	case *QueryOperator:
+		n.Left, n.Right = RewriteQuery(n.Left, fn), RewriteQuery(n.Right, fn)
+		if n.Left == nil {
+			return n.Right
+		}
+		if n.Right == nil {
+			return n.Left
+		}
+	case *QueryField:
+		if n.Child = RewriteQuery(n.Child, fn); n.Child == nil {
+			return nil
+		}
+	case *QueryZone:
+		if n.Child = RewriteQuery(n.Child, fn); n.Child == nil {
+			return nil
+		}
+	}
+	return fn(node)
+}
+
+func rewriteQueryList(nodes []QueryNode, fn func(QueryNode) QueryNode) []QueryNode {
+	res := nodes[:0]
+	for _, node := range nodes {
+		if node = RewriteQuery(node, fn); node != nil {
+			res = append(res, node)
+		}
+	}
+	return res
+}
@@ -0,0 +1,164 @@
+package manticore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseQuery_roundtrip(t *testing.T) {
+
+	queries := []string{
+		"hello world",
+		"hello | world",
+		"hello -world",
+		"looking for cat | dog | mouse",
+		`"hello world"`,
+		`"hello world"~10`,
+		`"the world is a wonderful place"/3`,
+		`"the world is a wonderful place"/0.5`,
+		"@title hello @body world",
+		"@(title,body) hello",
+		"@!title hello",
+		"@* hello",
+		"@body[50] hello",
+		"=exact ^start end$ boosted^1.5",
+		"aaa << bbb << ccc",
+		"hello NEAR/3 world NEAR/4 again",
+		"all SENTENCE words SENTENCE here",
+		"one NOTNEAR/3 two",
+		"a MAYBE b",
+		"ZONE:(h3,h4) only in these titles",
+		"ZONESPAN:(th) hello world",
+		"(a b) c",
+		"-(a | b) c",
+		`e\-mail \@home`,
+		"hel* w?rld",
+		"(@title a) b",
+	}
+
+	for _, query := range queries {
+		node, err := ParseQuery(query)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", query, err)
+			continue
+		}
+		if node.String() != query {
+			t.Errorf("%s: printed back as %s", query, node.String())
+		}
+	}
+}
+
+func TestParseQuery_precedence(t *testing.T) {
+
+	node, err := ParseQuery("looking for cat | dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	and, ok := node.(*QueryAnd)
+	if !ok || len(and.Children) != 3 {
+		t.Fatalf("expected AND of 3 items, got %#v", node)
+	}
+	if or, ok := and.Children[2].(*QueryOr); !ok || len(or.Children) != 2 {
+		t.Errorf("expected OR as last item, got %#v", and.Children[2])
+	}
+
+	node, err = ParseQuery("@title hello world @body foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	field, ok := node.(*QueryField)
+	if !ok || field.Fields[0] != "title" {
+		t.Fatalf("expected title field limit, got %#v", node)
+	}
+	rest := field.Child.(*QueryAnd)
+	if len(rest.Children) != 3 {
+		t.Errorf("expected field limit to cover rest of the query, got %v", rest)
+	}
+}
+
+func TestParseQuery_errors(t *testing.T) {
+
+	cases := []struct {
+		query string
+		pos   int
+	}{
+		{"hello (world", 6},
+		{"hello world)", 11},
+		{`"hello world`, 0},
+		{"hello | ", 8},
+		{"a NEAR/x b", 7},
+		{`"a b"~`, 6},
+		{"@ hello", 1},
+		{"@title", 6},
+		{"hello -", 6},
+		{"()", 0},
+		{"boost^x", 6},
+		{`tail\`, 5},
+	}
+
+	for _, c := range cases {
+		_, err := ParseQuery(c.query)
+		perr, ok := err.(*QueryParseError)
+		if !ok {
+			t.Errorf("%s: expected parse error, got %v", c.query, err)
+			continue
+		}
+		if perr.Pos != c.pos {
+			t.Errorf("%s: expected error at %d, got %v", c.query, c.pos, perr)
+		}
+	}
+}
+
+func TestRewriteQuery(t *testing.T) {
+
+	node, err := ParseQuery(`@secret hidden "quick brown fox"~100 | (@title fox)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	terms := 0
+	WalkQuery(node, func(n QueryNode) bool {
+		if _, ok := n.(*QueryTerm); ok {
+			terms++
+		}
+		return true
+	})
+	if terms != 5 {
+		t.Errorf("expected 5 terms, got %d", terms)
+	}
+
+	node = RewriteQuery(node, func(n QueryNode) QueryNode {
+		switch n := n.(type) {
+		case *QueryField:
+			return n.Child
+		case *QueryPhrase:
+			if n.Mode == PhraseProximity && n.Distance > 10 {
+				n.Distance = 10
+			}
+		case *QueryTerm:
+			if n.Word == "hidden" {
+				return nil
+			}
+		}
+		return n
+	})
+
+	if node.String() != `"quick brown fox"~10 | fox` {
+		t.Errorf("unexpected rewrite result: %s", node)
+	}
+}
+
+func ExampleParseQuery() {
+	node, err := ParseQuery(`@title hello|hi "big world"~3`)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Println(node)
+
+	_, err = ParseQuery(`hello (world`)
+	fmt.Println(err)
+	// Output:
+	// @title hello | hi "big world"~3
+	// query parse error at 6: unbalanced '('
+}
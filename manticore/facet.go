@@ -0,0 +1,159 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+)
+
+type searchFacet struct {
+	attr, orderby string
+	limit         int32
+}
+
+// FacetBucket is one group of facet returned from RunFacetedQuery() - value of the attribute and number of matches with it.
+type FacetBucket struct {
+	Value interface{} // value of the facet attribute (string for string attributes)
+	Count int         // number of matches
+}
+
+// Stringer interface for FacetBucket type
+func (vl FacetBucket) String() string {
+	return fmt.Sprintf("%v: %d", vl.Value, vl.Count)
+}
+
+/*
+AddFacet adds facet to the search query, to be executed by RunFacetedQuery().
+
+`attribute` is the name of attribute to build facet on.
+
+`orderby` is group sorting clause, like "@count desc" (used if empty) or "@groupby asc".
+
+`limit` is max number of buckets to return for the facet. Default 20 is used for zero.
+
+Facets don't affect RunQuery() and RunQueries() calls, they are only used by RunFacetedQuery().
+*/
+func (q *Search) AddFacet(attribute, orderby string, limit int32) {
+	if orderby == "" {
+		orderby = "@count desc"
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	q.facets = append(q.facets, searchFacet{attribute, orderby, limit})
+}
+
+// ResetFacets clears all the facets set by AddFacet()
+func (q *Search) ResetFacets() {
+	q.facets = nil
+}
+
+// buildFacetQueries makes batch for facet multi-query: head query first, and then one grouped query per facet
+func buildFacetQueries(q Search) []Search {
+	facets := q.facets
+	q.facets = nil
+
+	queries := make([]Search, 0, len(facets)+1)
+	head := q
+	head.SetQueryFlags(QflagFacetHead)
+	queries = append(queries, head)
+
+	for _, facet := range facets {
+		fq := q
+		fq.ResetOuterSelect()
+		fq.SetGroupBy(facet.attr, GroupbyAttr, facet.orderby)
+		fq.GroupDistinct = ""
+		fq.Offset, fq.Limit = 0, facet.limit
+		if fq.MaxMatches < fq.Limit {
+			fq.MaxMatches = fq.Limit
+		}
+		fq.SetQueryFlags(QflagFacet)
+		queries = append(queries, fq)
+	}
+	return queries
+}
+
+// facetBuckets extracts buckets from the result of grouped facet query
+func facetBuckets(res *QueryResult, attribute string) []FacetBucket {
+	groupby, count, value := -1, -1, -1
+	for i, col := range res.Attrs {
+		switch col.Name {
+		case "@groupby":
+			groupby = i
+		case "@count":
+			count = i
+		case attribute:
+			if col.Type != AttrUint32set && col.Type != AttrInt64set {
+				value = i
+			}
+		}
+	}
+	if value < 0 {
+		value = groupby
+	}
+
+	buckets := make([]FacetBucket, len(res.Matches))
+	for j, match := range res.Matches {
+		if value >= 0 {
+			buckets[j].Value = match.Attrs[value]
+			if str, ok := buckets[j].Value.(JsonOrStr); ok {
+				buckets[j].Value = str.Val
+			}
+		}
+		if count >= 0 {
+			cnt, _ := attrInt(match.Attrs[count])
+			buckets[j].Count = int(cnt)
+		}
+	}
+	return buckets
+}
+
+/*
+RunFacetedQuery runs search query `q` together with all it's facets, set by AddFacet(), in one multi-query batch.
+The main (head) query is marked with QflagFacetHead, and every facet query - with QflagFacet, so that daemon is able
+to share the matching work between them.
+
+Returns result of the main query, and the map of facet buckets with attribute names as keys.
+If the main query fails, it's error is returned. If one of facets fails, the main result and the rest of facets
+are still returned together with the error.
+
+Usage example:
+
+  q := NewSearch("phone", "products", "")
+  q.AddFacet("brand_name", "", 5)
+  q.AddFacet("price", "@groupby asc", 10)
+  res, facets, err := cl.RunFacetedQuery(q)
+  ...
+  for _, bucket := range facets["brand_name"] {
+    fmt.Println(bucket.Value, bucket.Count)
+  }
+*/
+func (cl *Client) RunFacetedQuery(q Search) (*QueryResult, map[string][]FacetBucket, error) {
+	if len(q.facets) == 0 {
+		return nil, nil, errors.New("no facets defined, issue AddFacet() first")
+	}
+
+	facets := q.facets
+	results, err := cl.RunQueries(buildFacetQueries(q))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	head := &results[0]
+	cl.lastWarning = head.Warning
+	if head.Status == StatusError || head.Status == StatusRetry {
+		return head, nil, errors.New(head.Error)
+	}
+
+	buckets := make(map[string][]FacetBucket, len(facets))
+	for i, facet := range facets {
+		res := &results[i+1]
+		if res.Status == StatusError || res.Status == StatusRetry {
+			if err == nil {
+				err = fmt.Errorf("facet '%s': %s", facet.attr, res.Error)
+			}
+			continue
+		}
+		buckets[facet.attr] = facetBuckets(res, facet.attr)
+	}
+	return head, buckets, err
+}
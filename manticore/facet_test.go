@@ -0,0 +1,65 @@
+package manticore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClient_RunFacetedQuery(t *testing.T) {
+	cl := NewClient()
+
+	q := NewSearch("query", "lj", "")
+	q.AddFacet("channel_id", "", 5)
+	q.AddFacet("published", "@groupby desc", 3)
+
+	res, facets, err := cl.RunFacetedQuery(q)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(res)
+		fmt.Println(facets)
+	}
+}
+
+func TestSearch_AddFacet(t *testing.T) {
+	q := NewSearch("query", "lj", "")
+	q.Limit = 50
+	q.AddFacet("channel_id", "", 0)
+	q.AddFacet("published", "@groupby asc", 3)
+
+	queries := buildFacetQueries(q)
+	if len(queries) != 3 {
+		t.Fatalf("expected 3 queries, got %d", len(queries))
+	}
+	if !queries[0].hasSetQueryFlag(QflagFacetHead) || queries[0].hasSetQueryFlag(QflagFacet) || queries[0].GroupBy != "" {
+		t.Errorf("unexpected head query flags %v, groupby '%s'", queries[0].queryflags, queries[0].GroupBy)
+	}
+	if queries[0].Limit != 50 {
+		t.Errorf("head limit changed to %d", queries[0].Limit)
+	}
+
+	facet := queries[1]
+	if !facet.hasSetQueryFlag(QflagFacet) || facet.GroupBy != "channel_id" || facet.Groupfunc != GroupbyAttr {
+		t.Errorf("unexpected facet query flags %v, groupby '%s'", facet.queryflags, facet.GroupBy)
+	}
+	if facet.GroupSort != "@count desc" || facet.Limit != 20 {
+		t.Errorf("unexpected facet defaults: sort '%s', limit %d", facet.GroupSort, facet.Limit)
+	}
+	if queries[2].GroupSort != "@groupby asc" || queries[2].Limit != 3 {
+		t.Errorf("unexpected facet: sort '%s', limit %d", queries[2].GroupSort, queries[2].Limit)
+	}
+}
+
+func TestFacetBuckets(t *testing.T) {
+	res := QueryResult{
+		Attrs: []ColumnInfo{{"brand", AttrString}, {"@groupby", AttrBigint}, {"@count", AttrInteger}},
+		Matches: []Match{
+			{1, 1, []interface{}{JsonOrStr{false, "acme"}, uint64(12345), uint32(10)}},
+			{7, 1, []interface{}{JsonOrStr{false, "globex"}, uint64(67890), uint32(3)}},
+		},
+	}
+	buckets := facetBuckets(&res, "brand")
+	if len(buckets) != 2 || buckets[0].Value != "acme" || buckets[0].Count != 10 || buckets[1].Count != 3 {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+}
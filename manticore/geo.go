@@ -0,0 +1,123 @@
+package manticore
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GeoPoint is a point on the geosphere, or vertex of a polygon. Units (degrees or radians) depend on the context.
+type GeoPoint struct {
+	Lat, Lon float32
+}
+
+func degToRad(deg float32) float32 {
+	return float32(float64(deg) * math.Pi / 180)
+}
+
+/*
+SetGeoAnchorDegrees works like SetGeoAnchor(), but `lat` and `long` are given in degrees, and converted to radians
+before sending to the daemon. Note that attributes `attrlat` and `attrlong` of the index still must contain
+values in radians, as geodistance is calculated over radians in API queries.
+*/
+func (q *Search) SetGeoAnchorDegrees(attrlat, attrlong string, lat, long float32) {
+	q.SetGeoAnchor(attrlat, attrlong, degToRad(lat), degToRad(long))
+}
+
+/*
+WithinRadius adds filter which leaves only matches closer than `meters` to the geo anchor.
+Geo anchor must be set by SetGeoAnchor() or SetGeoAnchorDegrees(), otherwise daemon will complain about unknown
+@geodist attribute.
+*/
+func (q *Search) WithinRadius(meters float32) {
+	q.AddFilterFloatRange("@geodist", 0, meters, false)
+}
+
+// SortByDistance sorts matches by distance from geo anchor, nearest first (or farthest first, if `desc` is true).
+// Matches with the same distance are sorted by relevance.
+func (q *Search) SortByDistance(desc bool) {
+	if desc {
+		q.SetSortMode(SortExtended, "@geodist DESC, @weight DESC")
+	} else {
+		q.SetSortMode(SortExtended, "@geodist ASC, @weight DESC")
+	}
+}
+
+/*
+AddFilterGeoBox adds filter which leaves only matches inside latitude/longitude bounding box.
+
+`attrlat` and `attrlong` are the names of latitude and longitude attributes.
+
+`min` and `max` are south-west and north-east corners of the box, in the same units as attributes are stored.
+If min.Lon is greater than max.Lon, the box is considered as crossing the antimeridian.
+*/
+func (q *Search) AddFilterGeoBox(attrlat, attrlong string, min, max GeoPoint) {
+	q.AddFilterFloatRange(attrlat, min.Lat, max.Lat, false)
+	if min.Lon <= max.Lon {
+		q.AddFilterFloatRange(attrlong, min.Lon, max.Lon, false)
+		return
+	}
+	q.AddFilterExpression(fmt.Sprintf("%s>=%s OR %s<=%s", attrlong, formatGeoFloat(min.Lon),
+		attrlong, formatGeoFloat(max.Lon)), false)
+}
+
+/*
+AddFilterPolygon adds filter which leaves only matches inside polygon, using CONTAINS() expression.
+
+`attrlat` and `attrlong` are the names of latitude and longitude attributes.
+
+`polygon` is the list of polygon vertices, at least 3 of them.
+
+`geo` selects kind of polygon. If false, POLY2D() is used - a plain polygon, where coordinates are in the same units
+as attributes. If true, GEOPOLY2D() is used - it takes Earth's curvature into account, and expects degrees.
+
+`exclude` controls whether to accept the matches inside the polygon (when false) or outside of it.
+
+Returns error and adds no filter, if polygon has less than 3 vertices.
+*/
+func (q *Search) AddFilterPolygon(attrlat, attrlong string, polygon []GeoPoint, geo, exclude bool) error {
+	if len(polygon) < 3 {
+		return fmt.Errorf("invalid arguments (polygon must have at least 3 vertices, %d given)", len(polygon))
+	}
+	q.AddFilterExpression(polygonExpression(attrlat, attrlong, polygon, geo), exclude)
+	return nil
+}
+
+func formatGeoFloat(val float32) string {
+	return strconv.FormatFloat(float64(val), 'g', -1, 32)
+}
+
+func polygonExpression(attrlat, attrlong string, polygon []GeoPoint, geo bool) string {
+	coords := make([]string, 0, 2*len(polygon))
+	for _, point := range polygon {
+		coords = append(coords, formatGeoFloat(point.Lat), formatGeoFloat(point.Lon))
+	}
+	fn := "POLY2D"
+	if geo {
+		fn = "GEOPOLY2D"
+	}
+	return fmt.Sprintf("CONTAINS(%s(%s), %s, %s)", fn, strings.Join(coords, ","), attrlat, attrlong)
+}
+
+// AttrIndex returns position of the attribute `name` in the result set schema (and so, in Attrs of each match),
+// or -1 if there is no such attribute.
+func (res *QueryResult) AttrIndex(name string) int {
+	for i, col := range res.Attrs {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GeoDistance returns calculated distance (in meters) from geo anchor to the match with number `j`.
+// Returns false if there is no such match, or the query had no geo anchor.
+func (res *QueryResult) GeoDistance(j int) (float32, bool) {
+	idx := res.AttrIndex("@geodist")
+	if idx < 0 || j < 0 || j >= len(res.Matches) {
+		return 0, false
+	}
+	dist, ok := res.Matches[j].Attrs[idx].(float32)
+	return dist, ok
+}
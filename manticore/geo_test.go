@@ -0,0 +1,71 @@
+package manticore
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSearch_SetGeoAnchorDegrees(t *testing.T) {
+	q := NewSearch("", "geo", "")
+	q.SetGeoAnchorDegrees("lat", "lon", 90, -180)
+	if math.Abs(float64(q.geoLatitude)-math.Pi/2) > 1e-6 || math.Abs(float64(q.geoLongitude)+math.Pi) > 1e-6 {
+		t.Errorf("unexpected anchor in radians: %v, %v", q.geoLatitude, q.geoLongitude)
+	}
+
+	q.WithinRadius(1000)
+	q.SortByDistance(false)
+	if len(q.filters) != 1 || q.filters[0].Attribute != "@geodist" || q.sortby != "@geodist ASC, @weight DESC" {
+		t.Errorf("unexpected filters %v, sort '%s'", q.filters, q.sortby)
+	}
+
+	cl := NewClient()
+	res, err := cl.RunQuery(q)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		for j := range res.Matches {
+			fmt.Println(res.GeoDistance(j))
+		}
+	}
+}
+
+func TestSearch_AddFilterGeoBox(t *testing.T) {
+	q := NewSearch("", "geo", "")
+	q.AddFilterGeoBox("lat", "lon", GeoPoint{10, 170}, GeoPoint{20, -170})
+	if len(q.filters) != 2 || q.filters[1].FilterType != FilterExpression {
+		t.Fatalf("unexpected filters %v", q.filters)
+	}
+	if q.filters[1].Attribute != "lon>=170 OR lon<=-170" {
+		t.Errorf("unexpected antimeridian filter %s", q.filters[1].Attribute)
+	}
+}
+
+func TestSearch_AddFilterPolygon(t *testing.T) {
+	q := NewSearch("", "geo", "")
+	if err := q.AddFilterPolygon("lat", "lon", []GeoPoint{{10, 10}, {10.5, 20}, {20, 20}}, true, false); err != nil {
+		t.Error(err)
+	}
+	if q.filters[0].Attribute != "CONTAINS(GEOPOLY2D(10,10,10.5,20,20,20), lat, lon)" {
+		t.Errorf("unexpected polygon filter %s", q.filters[0].Attribute)
+	}
+	if err := q.AddFilterPolygon("lat", "lon", []GeoPoint{{10, 10}, {20, 20}}, false, false); err == nil {
+		t.Error("polygon with 2 vertices must be rejected")
+	}
+	if len(q.filters) != 1 {
+		t.Errorf("unexpected %d filters", len(q.filters))
+	}
+}
+
+func TestQueryResult_GeoDistance(t *testing.T) {
+	res := QueryResult{
+		Attrs:   []ColumnInfo{{"gid", AttrInteger}, {"@geodist", AttrFloat}},
+		Matches: []Match{{1, 1, []interface{}{uint32(1), float32(123.5)}}},
+	}
+	if dist, ok := res.GeoDistance(0); !ok || dist != 123.5 {
+		t.Errorf("unexpected distance %v", dist)
+	}
+	if _, ok := res.GeoDistance(1); ok {
+		t.Errorf("expected no distance for absent match")
+	}
+}
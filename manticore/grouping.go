@@ -0,0 +1,165 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Group represents one group of group-by query result, see QueryResult.Grouped().
+type Group struct {
+	Key      interface{}   // value of @groupby, as it came from daemon
+	Parts    []interface{} // for GroupbyMultiple - values of each grouping attribute, in order of GroupBy clause
+	From, To time.Time     // for time buckets (GroupbyDay, GroupbyWeek, GroupbyMonth, GroupbyYear) - range [From, To)
+	Count    int           // number of matches in group (@count)
+	Distinct int           // number of distinct values of GroupDistinct attribute (@distinct), if requested
+	Match    *Match        // best match of the group
+}
+
+// Stringer interface for Group type
+func (vl Group) String() string {
+	line := fmt.Sprintf("Key: %v", vl.Key)
+	if vl.Parts != nil {
+		line += fmt.Sprintf(" %v", vl.Parts)
+	}
+	if !vl.From.IsZero() {
+		line += fmt.Sprintf(" [%v - %v)", vl.From.Format("2006-01-02"), vl.To.Format("2006-01-02"))
+	}
+	return line + fmt.Sprintf(", Count: %d, Distinct: %d", vl.Count, vl.Distinct)
+}
+
+// GroupedResult is the typed view of group-by query result
+type GroupedResult struct {
+	Func      EGroupBy // grouping function
+	Attribute string   // grouping attribute (or comma-separated list for GroupbyMultiple)
+	Groups    []Group
+}
+
+// attrInt converts integer attribute value into int64
+func attrInt(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case time.Time:
+		return v.Unix(), true
+	}
+	return 0, false
+}
+
+// timeBucket decodes magic @groupby value of time grouping functions into time range
+func timeBucket(gfunc EGroupBy, key int64, loc *time.Location) (from, to time.Time, err error) {
+	switch gfunc {
+	case GroupbyDay: // YYYYMMDD
+		from = time.Date(int(key/10000), time.Month(key/100%100), int(key%100), 0, 0, 0, 0, loc)
+		to = from.AddDate(0, 0, 1)
+		if from.Year() != int(key/10000) || int64(from.Month()) != key/100%100 || int64(from.Day()) != key%100 {
+			err = fmt.Errorf("invalid day bucket %d", key)
+		}
+	case GroupbyWeek: // YYYYNNN, NNN is 1-based day of the year of the Sunday which starts the week
+		from = time.Date(int(key/1000), time.January, 1, 0, 0, 0, 0, loc).AddDate(0, 0, int(key%1000)-1)
+		to = from.AddDate(0, 0, 7)
+		if key%1000 < 1 || key%1000 > 366 {
+			err = fmt.Errorf("invalid week bucket %d", key)
+		}
+	case GroupbyMonth: // YYYYMM
+		from = time.Date(int(key/100), time.Month(key%100), 1, 0, 0, 0, 0, loc)
+		to = from.AddDate(0, 1, 0)
+		if key%100 < 1 || key%100 > 12 {
+			err = fmt.Errorf("invalid month bucket %d", key)
+		}
+	case GroupbyYear: // YYYY
+		from = time.Date(int(key), time.January, 1, 0, 0, 0, 0, loc)
+		to = from.AddDate(1, 0, 0)
+	}
+	return
+}
+
+/*
+Grouped provides typed view of the result of group-by query `q`, with magic @groupby, @count and @distinct
+attributes extracted from each match.
+
+For time grouping functions (GroupbyDay, GroupbyWeek, GroupbyMonth and GroupbyYear) keys like YYYYMMDD are also
+decoded into time ranges in location `loc` (it should be the time zone of the daemon; UTC is used if nil).
+
+For GroupbyMultiple the values of each grouping attribute are placed into Parts. They are taken from the attributes
+with the same names, if present in the result set, otherwise @groupby is split by commas.
+
+Returns error if `q` is not a group-by query, or result has no @groupby attribute.
+*/
+func (res *QueryResult) Grouped(q *Search, loc *time.Location) (*GroupedResult, error) {
+	if q.GroupBy == "" {
+		return nil, errors.New("not a group-by query")
+	}
+	groupby := res.AttrIndex("@groupby")
+	if groupby < 0 {
+		return nil, errors.New("no @groupby attribute in the result set")
+	}
+	count, distinct := res.AttrIndex("@count"), res.AttrIndex("@distinct")
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var parts []int
+	var names []string
+	if q.Groupfunc == GroupbyMultiple {
+		names = strings.Split(q.GroupBy, ",")
+		parts = make([]int, len(names))
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+			parts[i] = res.AttrIndex(names[i])
+		}
+	}
+
+	grouped := GroupedResult{q.Groupfunc, q.GroupBy, make([]Group, len(res.Matches))}
+	for j := range res.Matches {
+		match := &res.Matches[j]
+		group := &grouped.Groups[j]
+		group.Match = match
+		group.Key = match.Attrs[groupby]
+		if count >= 0 {
+			cnt, _ := attrInt(match.Attrs[count])
+			group.Count = int(cnt)
+		}
+		if distinct >= 0 {
+			cnt, _ := attrInt(match.Attrs[distinct])
+			group.Distinct = int(cnt)
+		}
+
+		switch q.Groupfunc {
+		case GroupbyDay, GroupbyWeek, GroupbyMonth, GroupbyYear:
+			key, ok := attrInt(group.Key)
+			if !ok {
+				return nil, fmt.Errorf("unexpected @groupby value %v", group.Key)
+			}
+			var err error
+			if group.From, group.To, err = timeBucket(q.Groupfunc, key, loc); err != nil {
+				return nil, err
+			}
+		case GroupbyMultiple:
+			group.Parts = make([]interface{}, len(names))
+			var split []string
+			for i, idx := range parts {
+				if idx >= 0 {
+					group.Parts[i] = match.Attrs[idx]
+					continue
+				}
+				if split == nil {
+					split = strings.Split(fmt.Sprint(group.Key), ",")
+				}
+				if i < len(split) {
+					group.Parts[i] = strings.TrimSpace(split[i])
+				}
+			}
+		}
+	}
+	return &grouped, nil
+}
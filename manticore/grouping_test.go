@@ -0,0 +1,97 @@
+package manticore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueryResult_Grouped_time(t *testing.T) {
+	res := QueryResult{
+		Attrs: []ColumnInfo{{"published", AttrTimestamp}, {"@groupby", AttrInteger}, {"@count", AttrInteger},
+			{"@distinct", AttrInteger}},
+		Matches: []Match{
+			{1, 1, []interface{}{time.Unix(0, 0), uint32(20191231), uint32(10), uint32(2)}},
+			{2, 1, []interface{}{time.Unix(0, 0), uint32(20200229), uint32(3), uint32(1)}},
+		},
+	}
+
+	q := NewSearch("", "lj", "")
+	q.SetGroupBy("published", GroupbyDay)
+	q.GroupDistinct = "channel_id"
+	grouped, err := res.Grouped(&q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := grouped.Groups[0]
+	if first.Count != 10 || first.Distinct != 2 || !first.From.Equal(time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)) ||
+		!first.To.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected group %v", first)
+	}
+
+	res.Matches = res.Matches[:1]
+	buckets := []struct {
+		gfunc    EGroupBy
+		key      uint32
+		from, to string
+	}{
+		{GroupbyWeek, 2020005, "2020-01-05", "2020-01-12"},
+		{GroupbyWeek, 2028366, "2028-12-31", "2029-01-07"},
+		{GroupbyMonth, 202002, "2020-02-01", "2020-03-01"},
+		{GroupbyYear, 2020, "2020-01-01", "2021-01-01"},
+	}
+	for _, bucket := range buckets {
+		q.SetGroupBy("published", bucket.gfunc)
+		res.Matches[0].Attrs[1] = bucket.key
+		grouped, err := res.Grouped(&q, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		group := grouped.Groups[0]
+		if group.From.Format("2006-01-02") != bucket.from || group.To.Format("2006-01-02") != bucket.to {
+			t.Errorf("%d: unexpected range %v", bucket.key, group)
+		}
+	}
+
+	q.SetGroupBy("published", GroupbyMonth)
+	res.Matches[0].Attrs[1] = uint32(202013)
+	if _, err := res.Grouped(&q, nil); err == nil {
+		t.Errorf("expected error for invalid month")
+	}
+}
+
+func TestQueryResult_Grouped_multiple(t *testing.T) {
+	res := QueryResult{
+		Attrs: []ColumnInfo{{"a", AttrInteger}, {"@groupby", AttrString}, {"@count", AttrInteger}},
+		Matches: []Match{
+			{1, 1, []interface{}{uint32(5), JsonOrStr{false, "5, red"}, uint32(4)}},
+		},
+	}
+	q := NewSearch("", "lj", "")
+	q.SetGroupBy("a, color", GroupbyMultiple)
+	grouped, err := res.Grouped(&q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := grouped.Groups[0].Parts
+	if len(parts) != 2 || parts[0] != uint32(5) || parts[1] != "red" {
+		t.Errorf("unexpected parts %v", parts)
+	}
+}
+
+func TestClient_RunQuery_grouped(t *testing.T) {
+	cl := NewClient()
+	q := NewSearch("", "lj", "")
+	q.SetGroupBy("published", GroupbyMonth)
+	res, err := cl.RunQuery(q)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	grouped, err := res.Grouped(&q, time.Local)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(grouped.Groups)
+	}
+}
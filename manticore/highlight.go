@@ -0,0 +1,148 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+DocLoader provides texts of field `field` for documents `ids`, to build snippets from. It must return exactly one
+text per document, in the same order as `ids`. Used by RunQueryWithSnippetsFrom() for fields which are not stored
+as string attributes, so their content has to be fetched from the primary storage (database, files, etc.)
+*/
+type DocLoader func(field string, ids []DocID) ([]string, error)
+
+// SnippetAttr returns name of the attribute which holds snippet of the field, as attached by RunQueryWithSnippets().
+func SnippetAttr(field string) string {
+	return "snippet(" + field + ")"
+}
+
+// Snippet returns snippet of `field` for the match with number `j`, as attached by RunQueryWithSnippets().
+// Returns false if there is no such match, or no snippets for the field.
+func (res *QueryResult) Snippet(j int, field string) (string, bool) {
+	idx := res.AttrIndex(SnippetAttr(field))
+	if idx < 0 || j < 0 || j >= len(res.Matches) {
+		return "", false
+	}
+	str, ok := res.Matches[j].Attrs[idx].(JsonOrStr)
+	return str.Val, ok
+}
+
+// snippetDocs collects texts of `field` for all the matches: from string attribute with the same name, if any,
+// or from the loader otherwise.
+func (res *QueryResult) snippetDocs(field string, loader DocLoader) ([]string, error) {
+	docs := make([]string, len(res.Matches))
+	if idx := res.AttrIndex(field); idx >= 0 {
+		for j, match := range res.Matches {
+			switch val := match.Attrs[idx].(type) {
+			case JsonOrStr:
+				docs[j] = val.Val
+			case string:
+				docs[j] = val
+			case []byte:
+				docs[j] = string(val)
+			default:
+				return nil, fmt.Errorf("attribute '%s' of type %v can't be used as snippet source",
+					field, res.Attrs[idx].Type)
+			}
+		}
+		return docs, nil
+	}
+
+	if loader == nil {
+		return nil, fmt.Errorf("field '%s' is not in the result set, and no document loader provided", field)
+	}
+	ids := make([]DocID, len(res.Matches))
+	for j, match := range res.Matches {
+		ids[j] = match.DocID
+	}
+	docs, err := loader(field, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) != len(ids) {
+		return nil, fmt.Errorf("document loader returned %d texts of field '%s' for %d documents",
+			len(docs), field, len(ids))
+	}
+	return docs, nil
+}
+
+// attachSnippets appends snippets of the field to every match as string attribute. Schema and matches are copied,
+// since result may be shared with the cache.
+func (res *QueryResult) attachSnippets(field string, snippets []string) {
+	attrs := make([]ColumnInfo, len(res.Attrs), len(res.Attrs)+1)
+	copy(attrs, res.Attrs)
+	res.Attrs = append(attrs, ColumnInfo{SnippetAttr(field), AttrString})
+
+	matches := make([]Match, len(res.Matches))
+	for j, match := range res.Matches {
+		values := make([]interface{}, len(match.Attrs), len(match.Attrs)+1)
+		copy(values, match.Attrs)
+		match.Attrs = append(values, JsonOrStr{false, snippets[j]})
+		matches[j] = match
+	}
+	res.Matches = matches
+}
+
+/*
+RunQueryWithSnippets runs the search query, and builds snippets of given `fields` for all the matches, highlighting
+the words of Search.Query with options `opts`. Texts of the fields are taken from the string attributes with the
+same names, so they must be stored and selected by the query.
+
+Snippets are built with one BuildExcerpts() request per field, over the first index of the query (so it must not be
+"*"), and attached to the matches as string attributes named SnippetAttr(field). Use QueryResult.Snippet() to get
+them. Consider to set ExcerptFlagQuery in `opts`, if the query uses extended syntax.
+
+If the query failed (result has StatusError), or found nothing, result is returned as is.
+
+Usage example:
+
+  res, err := cl.RunQueryWithSnippets(NewSearch("hello world", "lj", ""), *NewSnippetOptions(), "title")
+  if err == nil {
+    for j := range res.Matches {
+      snippet, _ := res.Snippet(j, "title")
+      fmt.Println(snippet)
+    }
+  }
+*/
+func (cl *Client) RunQueryWithSnippets(q Search, opts SnippetOptions, fields ...string) (*QueryResult, error) {
+	return cl.RunQueryWithSnippetsFrom(q, opts, nil, fields...)
+}
+
+// RunQueryWithSnippetsFrom works like RunQueryWithSnippets, but texts of the fields which are not in the result set
+// are requested from `loader`.
+func (cl *Client) RunQueryWithSnippetsFrom(q Search, opts SnippetOptions, loader DocLoader,
+	fields ...string) (*QueryResult, error) {
+
+	if len(fields) == 0 {
+		return nil, errors.New("invalid arguments (fields must not be empty)")
+	}
+	if q.Query == "" {
+		return nil, errors.New("invalid arguments (query must not be empty)")
+	}
+	indexes := splitIndexes(q.Indexes)
+	if len(indexes) == 0 || indexes[0] == "*" {
+		return nil, errors.New("invalid arguments (query must have explicit index to build snippets)")
+	}
+
+	res, err := cl.RunQuery(q)
+	if err != nil || res.Status == StatusError || len(res.Matches) == 0 {
+		return res, err
+	}
+
+	for _, field := range fields {
+		docs, err := res.snippetDocs(field, loader)
+		if err != nil {
+			return nil, err
+		}
+		snippets, err := cl.BuildExcerpts(docs, indexes[0], q.Query, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(snippets) != len(docs) {
+			return nil, fmt.Errorf("got %d snippets of field '%s' for %d documents", len(snippets), field, len(docs))
+		}
+		res.attachSnippets(field, snippets)
+	}
+	return res, nil
+}
@@ -0,0 +1,92 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestQueryResult_snippetDocs(t *testing.T) {
+
+	res := QueryResult{
+		Attrs: []ColumnInfo{{"title", AttrString}, {"gid", AttrInteger}},
+		Matches: []Match{
+			{1, 1, []interface{}{JsonOrStr{false, "first title"}, uint32(1)}},
+			{2, 1, []interface{}{JsonOrStr{false, "second title"}, uint32(2)}},
+		},
+	}
+
+	docs, err := res.snippetDocs("title", nil)
+	if err != nil || !reflect.DeepEqual(docs, []string{"first title", "second title"}) {
+		t.Errorf("unexpected docs from attribute %v (%v)", docs, err)
+	}
+	if _, err = res.snippetDocs("gid", nil); err == nil {
+		t.Error("expected error for numeric attribute")
+	}
+	if _, err = res.snippetDocs("body", nil); err == nil {
+		t.Error("expected error for absent field without loader")
+	}
+
+	loader := func(field string, ids []DocID) ([]string, error) {
+		texts := make([]string, len(ids))
+		for i, id := range ids {
+			texts[i] = fmt.Sprintf("%s of %d", field, id)
+		}
+		return texts, nil
+	}
+	docs, err = res.snippetDocs("body", loader)
+	if err != nil || !reflect.DeepEqual(docs, []string{"body of 1", "body of 2"}) {
+		t.Errorf("unexpected docs from loader %v (%v)", docs, err)
+	}
+
+	short := func(field string, ids []DocID) ([]string, error) {
+		return []string{"one"}, nil
+	}
+	if _, err = res.snippetDocs("body", short); err == nil {
+		t.Error("expected error for loader returned wrong number of texts")
+	}
+	failing := func(field string, ids []DocID) ([]string, error) {
+		return nil, errors.New("storage is down")
+	}
+	if _, err = res.snippetDocs("body", failing); err == nil || err.Error() != "storage is down" {
+		t.Errorf("expected loader error, got %v", err)
+	}
+}
+
+func TestQueryResult_attachSnippets(t *testing.T) {
+
+	attrs := make([]ColumnInfo, 1, 10)
+	attrs[0] = ColumnInfo{"title", AttrString}
+	shared := QueryResult{Attrs: attrs, Matches: []Match{{1, 1, []interface{}{JsonOrStr{false, "hello"}}}}}
+
+	res := shared
+	res.attachSnippets("title", []string{"<b>hello</b>"})
+	snippet, ok := res.Snippet(0, "title")
+	if !ok || snippet != "<b>hello</b>" {
+		t.Errorf("unexpected snippet %s", snippet)
+	}
+	if len(shared.Attrs) != 1 || len(shared.Matches[0].Attrs) != 1 {
+		t.Error("original result must not be modified")
+	}
+	if _, ok = res.Snippet(1, "title"); ok {
+		t.Error("expected no snippet for absent match")
+	}
+	if _, ok = res.Snippet(0, "body"); ok {
+		t.Error("expected no snippet for absent field")
+	}
+}
+
+func TestClient_RunQueryWithSnippets(t *testing.T) {
+
+	cl := NewClient()
+	q := NewSearch("luther", "lj", "")
+	res, err := cl.RunQueryWithSnippets(q, *NewSnippetOptions(), "title")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	for j := range res.Matches {
+		fmt.Println(res.Snippet(j, "title"))
+	}
+}
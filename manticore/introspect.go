@@ -0,0 +1,302 @@
+package manticore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TableInfo is one table returned by ListTables(). `Type` is as daemon reports it: "rt", "percolate",
+// "distributed", "local", "template", etc.
+type TableInfo struct {
+	Name string
+	Type string
+}
+
+// TableColumn is one column returned by DescribeTable(). Embedded Column has the type and indexed/stored flags
+// decoded, so it may be passed back to AlterTable(). `TypeName` and `Properties` are as daemon reports them; for
+// types which SDK doesn't know Type is AttrNone, so check `TypeName` then.
+type TableColumn struct {
+	Column
+	TypeName   string
+	Properties []string
+}
+
+// QueryTimings are statistics of queries over the table for some period, as in 'query_time_1min' of table status.
+// Durations are zero, if there were no queries in the period.
+type QueryTimings struct {
+	Queries                     int
+	Avg, Min, Max, Pct95, Pct99 time.Duration
+}
+
+// TableStatus is status of the table returned by TableStatus(). Counters which daemon doesn't report for the table
+// (say, RAM chunk of plain table) are zero. All the variables as is are also in `Vars`.
+type TableStatus struct {
+	Type             string
+	IndexedDocuments int64
+	IndexedBytes     int64
+	RamBytes         int64
+	DiskBytes        int64
+	RamChunk         int64
+	RamChunkSegments int
+	DiskChunks       int
+	MemLimit         int64
+	KilledDocuments  int64
+	QueryTime1Min    QueryTimings
+	QueryTime5Min    QueryTimings
+	QueryTime15Min   QueryTimings
+	QueryTimeTotal   QueryTimings
+	Vars             map[string]string
+}
+
+// sqlRows runs sphinxql statement, and returns rows of the result with all values as strings
+func (cl *Client) sqlRows(stmt string) ([][]string, error) {
+	rs, err := cl.sqlExec(stmt)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]string, len(rs.Rows))
+	for i, row := range rs.Rows {
+		rows[i] = make([]string, len(row))
+		for j, value := range row {
+			rows[i][j] = fmt.Sprint(value)
+		}
+	}
+	return rows, nil
+}
+
+// columnType decodes type of DESCRIBE result into attribute type
+func columnType(tp string) EAttrType {
+	switch tp {
+	case "uint", "integer":
+		return AttrInteger
+	case "bigint":
+		return AttrBigint
+	case "float":
+		return AttrFloat
+	case "bool":
+		return AttrBool
+	case "timestamp":
+		return AttrTimestamp
+	case "string":
+		return AttrString
+	case "json":
+		return AttrJson
+	case "mva", "multi":
+		return AttrUint32set
+	case "mva64", "multi64":
+		return AttrInt64set
+	case "tokencount":
+		return AttrTokencount
+	}
+	return AttrNone
+}
+
+func parseDescribe(rows [][]string) []TableColumn {
+	columns := make([]TableColumn, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		col := TableColumn{TypeName: row[1]}
+		col.Name = row[0]
+		col.Type = columnType(row[1])
+		if len(row) > 2 && row[2] != "" {
+			col.Properties = strings.Fields(row[2])
+		}
+		for _, prop := range col.Properties {
+			switch prop {
+			case "indexed":
+				col.Indexed = true
+			case "stored":
+				col.Stored = true
+			}
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// parseQueryTimings decodes JSON like {"queries":1, "avg_sec":0.001, "min_sec":0.001, ...}, where times may be "-"
+func parseQueryTimings(value string) QueryTimings {
+	var stats map[string]interface{}
+	var timings QueryTimings
+	if json.Unmarshal([]byte(value), &stats) != nil {
+		return timings
+	}
+	seconds := func(name string) time.Duration {
+		if secs, ok := stats[name].(float64); ok {
+			return time.Duration(secs * float64(time.Second))
+		}
+		return 0
+	}
+	if queries, ok := stats["queries"].(float64); ok {
+		timings.Queries = int(queries)
+	}
+	timings.Avg, timings.Min, timings.Max = seconds("avg_sec"), seconds("min_sec"), seconds("max_sec")
+	timings.Pct95, timings.Pct99 = seconds("pct95_sec"), seconds("pct99_sec")
+	return timings
+}
+
+func parseTableStatus(rows [][]string) *TableStatus {
+	status := TableStatus{Vars: make(map[string]string)}
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		name, value := row[0], row[1]
+		status.Vars[name] = value
+		num, _ := strconv.ParseInt(value, 10, 64)
+		switch name {
+		case "index_type", "table_type":
+			status.Type = value
+		case "indexed_documents":
+			status.IndexedDocuments = num
+		case "indexed_bytes":
+			status.IndexedBytes = num
+		case "ram_bytes":
+			status.RamBytes = num
+		case "disk_bytes":
+			status.DiskBytes = num
+		case "ram_chunk":
+			status.RamChunk = num
+		case "ram_chunk_segments_count":
+			status.RamChunkSegments = int(num)
+		case "disk_chunks":
+			status.DiskChunks = int(num)
+		case "mem_limit":
+			status.MemLimit = num
+		case "killed_documents":
+			status.KilledDocuments = num
+		case "query_time_1min":
+			status.QueryTime1Min = parseQueryTimings(value)
+		case "query_time_5min":
+			status.QueryTime5Min = parseQueryTimings(value)
+		case "query_time_15min":
+			status.QueryTime15Min = parseQueryTimings(value)
+		case "query_time_total":
+			status.QueryTimeTotal = parseQueryTimings(value)
+		}
+	}
+	return &status
+}
+
+// parseTableSettings decodes settings text, one "name = value" per line
+func parseTableSettings(text string) *TableSettings {
+	var settings TableSettings
+	for _, line := range strings.Split(text, "\n") {
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue
+		}
+		name, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		num, _ := strconv.Atoi(value)
+		switch name {
+		case "morphology":
+			settings.Morphology = value
+		case "min_word_len":
+			settings.MinWordLen = num
+		case "min_infix_len":
+			settings.MinInfixLen = num
+		case "min_prefix_len":
+			settings.MinPrefixLen = num
+		case "html_strip":
+			settings.HtmlStrip = num != 0
+		case "charset_table":
+			settings.CharsetTable = value
+		case "stopwords":
+			settings.Stopwords = value
+		case "":
+		default:
+			if settings.Other == nil {
+				settings.Other = make(map[string]string)
+			}
+			settings.Other[name] = value
+		}
+	}
+	return &settings
+}
+
+/*
+ListTables returns all the tables served by the daemon, with their types (SHOW TABLES).
+
+Usage example:
+
+  tables, err := cl.ListTables()
+  if err == nil {
+    for _, table := range tables {
+      fmt.Println(table.Name, table.Type)
+    }
+  }
+*/
+func (cl *Client) ListTables() ([]TableInfo, error) {
+	rows, err := cl.sqlRows("SHOW TABLES")
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]TableInfo, 0, len(rows))
+	for _, row := range rows {
+		if len(row) >= 2 {
+			tables = append(tables, TableInfo{row[0], row[1]})
+		}
+	}
+	return tables, nil
+}
+
+/*
+DescribeTable returns columns of the table (DESCRIBE), including implicit 'id'. It may be used, say, to validate
+attribute names before building filters.
+
+Usage example:
+
+  columns, err := cl.DescribeTable("products")
+  if err == nil {
+    for _, col := range columns {
+      fmt.Println(col.Name, col.Type, col.Properties)
+    }
+  }
+*/
+func (cl *Client) DescribeTable(name string) ([]TableColumn, error) {
+	if !isSQLIdent(name) {
+		return nil, fmt.Errorf("invalid table name '%s'", name)
+	}
+	rows, err := cl.sqlRows("DESCRIBE " + name)
+	if err != nil {
+		return nil, err
+	}
+	return parseDescribe(rows), nil
+}
+
+// TableStatus returns counters of the table: number of documents, sizes, chunks and query timings
+// (SHOW INDEX ... STATUS).
+func (cl *Client) TableStatus(name string) (*TableStatus, error) {
+	if !isSQLIdent(name) {
+		return nil, fmt.Errorf("invalid table name '%s'", name)
+	}
+	rows, err := cl.sqlRows("SHOW INDEX " + name + " STATUS")
+	if err != nil {
+		return nil, err
+	}
+	return parseTableStatus(rows), nil
+}
+
+// TableSettings returns settings of the table (SHOW INDEX ... SETTINGS). Known settings are decoded into fields,
+// and the rest are put to `Other`.
+func (cl *Client) TableSettings(name string) (*TableSettings, error) {
+	if !isSQLIdent(name) {
+		return nil, fmt.Errorf("invalid table name '%s'", name)
+	}
+	rows, err := cl.sqlRows("SHOW INDEX " + name + " SETTINGS")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row) >= 2 && row[0] == "settings" {
+			return parseTableSettings(row[1]), nil
+		}
+	}
+	return nil, errors.New("no 'settings' in answer")
+}
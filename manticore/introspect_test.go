@@ -0,0 +1,78 @@
+package manticore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDescribe(t *testing.T) {
+
+	columns := parseDescribe([][]string{
+		{"id", "bigint", ""},
+		{"title", "text", "indexed stored"},
+		{"sku", "string", "indexed attribute"},
+		{"tags", "mva", ""},
+		{"vec", "float_vector", ""},
+	})
+	expected := []TableColumn{
+		{Column{"id", AttrBigint, false, false}, "bigint", nil},
+		{Column{"title", AttrNone, true, true}, "text", []string{"indexed", "stored"}},
+		{Column{"sku", AttrString, true, false}, "string", []string{"indexed", "attribute"}},
+		{Column{"tags", AttrUint32set, false, false}, "mva", nil},
+		{Column{"vec", AttrNone, false, false}, "float_vector", nil},
+	}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Errorf("unexpected columns %v", columns)
+	}
+}
+
+func TestParseTableStatus(t *testing.T) {
+
+	status := parseTableStatus([][]string{
+		{"index_type", "rt"},
+		{"indexed_documents", "12"},
+		{"ram_bytes", "4096"},
+		{"disk_chunks", "2"},
+		{"query_time_1min", `{"queries":3, "avg_sec":0.002, "min_sec":0.001, "max_sec":0.004, "pct95_sec":0.004, "pct99_sec":0.004}`},
+		{"query_time_total", `{"queries":0, "avg_sec":"-", "min_sec":"-", "max_sec":"-", "pct95_sec":"-", "pct99_sec":"-"}`},
+	})
+	if status.Type != "rt" || status.IndexedDocuments != 12 || status.RamBytes != 4096 || status.DiskChunks != 2 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	expected := QueryTimings{3, 2 * time.Millisecond, time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond,
+		4 * time.Millisecond}
+	if status.QueryTime1Min != expected {
+		t.Errorf("unexpected timings %+v", status.QueryTime1Min)
+	}
+	if status.QueryTimeTotal != (QueryTimings{}) {
+		t.Errorf("unexpected timings %+v", status.QueryTimeTotal)
+	}
+	if status.Vars["disk_chunks"] != "2" {
+		t.Error("vars are not kept")
+	}
+}
+
+func TestParseTableSettings(t *testing.T) {
+
+	settings := parseTableSettings("morphology = stem_en\nmin_infix_len = 3\nhtml_strip = 1\nngram_len = 1\n")
+	expected := TableSettings{Morphology: "stem_en", MinInfixLen: 3, HtmlStrip: true,
+		Other: map[string]string{"ngram_len": "1"}}
+	if !reflect.DeepEqual(*settings, expected) {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+}
+
+func ExampleClient_DescribeTable() {
+
+	cl := NewClient()
+	columns, err := cl.DescribeTable("testrt")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	for _, col := range columns {
+		fmt.Println(col.Name, col.Type, col.Properties)
+	}
+}
@@ -0,0 +1,609 @@
+package manticore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// name of script field which holds distance to geo anchor in JSON query
+const jsonGeodistField = "geodist"
+
+var sqlSelectAlias = regexp.MustCompile(`(?is)^(.+)\s+as\s+([\w]+)$`)
+
+// jsonSource splits select clause into plain attributes for `_source`, and expressions for `script_fields`
+func jsonSource(clause string, scripts map[string]interface{}) ([]string, error) {
+	if clause == "" || clause == "*" {
+		return nil, nil
+	}
+	tokens, err := tokenizeSQL(clause)
+	if err != nil {
+		return nil, err
+	}
+	p := sqlParser{stmt: clause, tokens: tokens}
+	items := p.list("")
+	if p.peek().kind != sqlEOF {
+		return nil, fmt.Errorf("invalid select clause '%s'", clause)
+	}
+	var source []string
+	for _, item := range items {
+		if m := sqlSelectAlias.FindStringSubmatch(item); m != nil {
+			scripts[m[2]] = map[string]interface{}{"script": map[string]interface{}{"inline": strings.TrimSpace(m[1])}}
+			source = append(source, m[2])
+		} else if item == "*" || isSQLIdent(item) {
+			source = append(source, item)
+		} else {
+			return nil, fmt.Errorf("expression '%s' in select clause must have alias", item)
+		}
+	}
+	return source, nil
+}
+
+func isSQLIdent(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if !isSQLIdentChar(str[i]) {
+			return false
+		}
+	}
+	return str != ""
+}
+
+// jsonSort converts API sorting clause into JSON sort array
+func jsonSort(clause string) ([]interface{}, error) {
+	var items []interface{}
+	for _, key := range parseSortClause(clause) {
+		name := key.name
+		switch name {
+		case "@weight":
+			name = "_score"
+		case "@id":
+			name = "id"
+		case "@geodist":
+			name = jsonGeodistField
+		case "@groupby", "@count":
+			return nil, fmt.Errorf("sorting by %s can't be expressed in JSON query", name)
+		}
+		order := "asc"
+		if key.desc {
+			order = "desc"
+		}
+		items = append(items, map[string]interface{}{name: order})
+	}
+	return items, nil
+}
+
+// jsonFilter converts filter into condition of JSON bool query
+func (q *Search) jsonFilter(filter *searchFilter, scripts map[string]interface{}) (interface{}, error) {
+	attr := filter.Attribute
+	switch filter.FilterType {
+	case FilterValues:
+		values := filter.FilterData.([]int64)
+		if len(values) == 1 {
+			return map[string]interface{}{"equals": map[string]interface{}{attr: values[0]}}, nil
+		}
+		return map[string]interface{}{"in": map[string]interface{}{attr: values}}, nil
+	case FilterRange:
+		foo := filter.FilterData.([]int64)
+		bounds := make(map[string]interface{})
+		if foo[0] != math.MinInt64 {
+			bounds["gte"] = foo[0]
+		}
+		if foo[1] != math.MaxInt64 {
+			bounds["lte"] = foo[1]
+		}
+		return map[string]interface{}{"range": map[string]interface{}{attr: bounds}}, nil
+	case FilterFloatrange:
+		foo := filter.FilterData.([]float32)
+		if attr == "@geodist" {
+			if foo[0] != 0 || filter.Exclude {
+				return nil, errors.New("only @geodist filter from zero can be expressed in JSON query")
+			}
+			return map[string]interface{}{"geo_distance": map[string]interface{}{
+				"location_anchor": map[string]interface{}{
+					"lat": radToDeg(q.geoLatitude),
+					"lon": radToDeg(q.geoLongitude),
+				},
+				"location_source": q.geoLatAttr + "," + q.geoLonAttr,
+				"distance_type":   "adaptive",
+				"distance":        strconv.FormatFloat(float64(foo[1]), 'f', -1, 32) + " m",
+			}}, nil
+		}
+		bounds := make(map[string]interface{})
+		if foo[0] != -math.MaxFloat32 {
+			bounds["gte"] = foo[0]
+		}
+		if foo[1] != math.MaxFloat32 {
+			bounds["lte"] = foo[1]
+		}
+		return map[string]interface{}{"range": map[string]interface{}{attr: bounds}}, nil
+	case FilterString:
+		return map[string]interface{}{"equals": map[string]interface{}{attr: filter.FilterData.(string)}}, nil
+	case FilterStringList:
+		return map[string]interface{}{"in": map[string]interface{}{attr: filter.FilterData.([]string)}}, nil
+	case FilterExpression:
+		// expression is calculated as script field, and then filtered as any other attribute; the name must not
+		// collide with aliases of select clause, which are already in `scripts`
+		name := ""
+		for n := len(scripts); name == ""; n++ {
+			name = fmt.Sprintf("filter_%d", n)
+			if _, taken := scripts[name]; taken {
+				name = ""
+			}
+		}
+		scripts[name] = map[string]interface{}{"script": map[string]interface{}{"inline": attr}}
+		return map[string]interface{}{"equals": map[string]interface{}{name: 1}}, nil
+	}
+	return nil, fmt.Errorf("filter of type %d on '%s' can't be expressed in JSON query", filter.FilterType, attr)
+}
+
+func (q *Search) jsonOptions() (map[string]interface{}, error) {
+	opts := make(map[string]interface{})
+	switch q.ranker {
+	case RankProximityBm25:
+	case RankExpr, RankExport:
+		opts["ranker"] = fmt.Sprintf("%s(%s)", sqlRankers[q.ranker], quoteSQLString(q.rankexpr))
+	case RankPlugin:
+		return nil, errors.New("plugin ranker can't be expressed in JSON query")
+	default:
+		if q.ranker >= RankTotal {
+			return nil, fmt.Errorf("unknown ranker %d", q.ranker)
+		}
+		opts["ranker"] = sqlRankers[q.ranker]
+	}
+	if len(q.FieldWeights) != 0 {
+		opts["field_weights"] = q.FieldWeights
+	}
+	if len(q.IndexWeights) != 0 {
+		opts["index_weights"] = q.IndexWeights
+	}
+	opts["max_matches"] = q.MaxMatches
+	if q.CutOff != 0 {
+		opts["cutoff"] = q.CutOff
+	}
+	if q.MaxQueryTime != 0 {
+		opts["max_query_time"] = int64(q.MaxQueryTime / time.Millisecond)
+	}
+	if q.RetryCount != 0 {
+		opts["retry_count"] = q.RetryCount
+	}
+	if q.RetryDelay != 0 {
+		opts["retry_delay"] = int64(q.RetryDelay / time.Millisecond)
+	}
+	if q.hasSetQueryFlag(QflagMaxPredictedTime) {
+		opts["max_predicted_time"] = int64(q.predictedTime / time.Millisecond)
+	}
+	if q.hasSetQueryFlag(QFlagSortKbuffer) {
+		opts["sort_method"] = "kbuffer"
+	}
+	flags := []struct {
+		name string
+		flag Qflags
+	}{
+		{"reverse_scan", QflagReverseScan},
+		{"boolean_simplify", QflagSimplify},
+		{"global_idf", QflagGlobalIdf},
+		{"local_df", QflagLocalDf},
+		{"low_priority", QflagLowPriority},
+	}
+	for _, item := range flags {
+		if q.hasSetQueryFlag(item.flag) {
+			opts[item.name] = 1
+		}
+	}
+	if q.hasSetQueryFlag(QflagPlainIdf) || !q.hasSetQueryFlag(QflagNormalizedTfIdf) {
+		idf := []string{"normalized", "tfidf_unnormalized"}
+		if q.hasSetQueryFlag(QflagPlainIdf) {
+			idf[0] = "plain"
+		}
+		if q.hasSetQueryFlag(QflagNormalizedTfIdf) {
+			idf[1] = "tfidf_normalized"
+		}
+		opts["idf"] = strings.Join(idf, ",")
+	}
+	if q.Comment != "" {
+		opts["comment"] = q.Comment
+	}
+	return opts, nil
+}
+
+/*
+ToJSONQuery produces request for "json/search" endpoint (or HTTP /search), equivalent to the search query.
+It may be sent with Client.Json() call, or over HTTP; RunJSONQuery() does the first.
+
+Full-text query becomes `query_string`, and filters - conditions of `bool` query: `equals`, `in` and `range`;
+excluding filters go to `must_not`. Filter by @geodist (as set by WithinRadius) becomes `geo_distance` with
+anchor converted to degrees. Distance for sorting, as well as expressions of select clause and expression
+filters are provided as `script_fields`. Grouping by attribute becomes `terms` aggregation named after the
+attribute, sorted by GroupSort.
+
+Returns error for the settings which have no JSON equivalent, as null or uservar filters, grouping by time
+functions or by multiple attributes, count-distinct, sorting by time segments or by expression, token filter,
+and outer select.
+*/
+func (q *Search) ToJSONQuery() ([]byte, error) {
+	switch {
+	case q.sort == SortTimeSegments || q.sort == SortExpr:
+		return nil, fmt.Errorf("sort mode %d can't be expressed in JSON query", q.sort)
+	case q.tokenFlibrary != "":
+		return nil, errors.New("token filter can't be expressed in JSON query")
+	case q.hasouter:
+		return nil, errors.New("outer select can't be expressed in JSON query")
+	case q.GroupBy != "" && q.Groupfunc != GroupbyAttr:
+		return nil, fmt.Errorf("grouping function %d can't be expressed in JSON query", q.Groupfunc)
+	case q.GroupDistinct != "":
+		return nil, errors.New("count-distinct can't be expressed in JSON query")
+	}
+
+	request := map[string]interface{}{
+		"index":  strings.Join(splitIndexes(q.Indexes), ","),
+		"offset": q.Offset,
+		"limit":  q.Limit,
+	}
+	scripts := make(map[string]interface{})
+	source, err := jsonSource(q.SelectClause, scripts)
+	if err != nil {
+		return nil, err
+	}
+	if source != nil {
+		request["_source"] = source
+	}
+
+	var must, mustNot []interface{}
+	if q.Query != "" {
+		must = append(must, map[string]interface{}{"query_string": q.Query})
+	}
+	for i := range q.filters {
+		cond, err := q.jsonFilter(&q.filters[i], scripts)
+		if err != nil {
+			return nil, err
+		}
+		if q.filters[i].Exclude {
+			mustNot = append(mustNot, cond)
+		} else {
+			must = append(must, cond)
+		}
+	}
+	if q.IDMin != 0 || (q.IDMax != 0 && q.IDMax != DocidMax) {
+		bounds := map[string]interface{}{"gte": q.IDMin}
+		if q.IDMax != 0 && q.IDMax != DocidMax {
+			bounds["lte"] = q.IDMax
+		}
+		must = append(must, map[string]interface{}{"range": map[string]interface{}{"id": bounds}})
+	}
+	switch {
+	case len(mustNot) != 0:
+		request["query"] = map[string]interface{}{"bool": map[string]interface{}{"must": must, "must_not": mustNot}}
+	case len(must) == 1:
+		request["query"] = must[0]
+	case len(must) > 1:
+		request["query"] = map[string]interface{}{"bool": map[string]interface{}{"must": must}}
+	default:
+		request["query"] = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+
+	var sorting []interface{}
+	switch q.sort {
+	case SortAttrDesc:
+		sorting, err = jsonSort(q.sortby + " desc")
+	case SortAttrAsc:
+		sorting, err = jsonSort(q.sortby + " asc")
+	case SortExtended:
+		sorting, err = jsonSort(q.sortby)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sorting != nil {
+		request["sort"] = sorting
+	}
+	if q.hasGeoAnchor() && strings.Contains(q.sortby, "@geodist") {
+		scripts[jsonGeodistField] = map[string]interface{}{"script": map[string]interface{}{
+			"inline": fmt.Sprintf("GEODIST(%s, %s, %s, %s, {in=rad, out=m})", q.geoLatAttr, q.geoLonAttr,
+				formatSQLFloat(q.geoLatitude), formatSQLFloat(q.geoLongitude)),
+		}}
+	}
+	if len(scripts) != 0 {
+		request["script_fields"] = scripts
+	}
+
+	if q.GroupBy != "" {
+		terms := map[string]interface{}{"terms": map[string]interface{}{"field": q.GroupBy, "size": q.MaxMatches}}
+		var groupsort []interface{}
+		for _, key := range parseSortClause(q.GroupSort) {
+			name := key.name
+			switch name {
+			case "@groupby":
+				name = q.GroupBy
+			case "@count":
+				name = "count(*)"
+			case "@weight":
+				return nil, errors.New("sorting groups by weight can't be expressed in JSON query")
+			}
+			order := "asc"
+			if key.desc {
+				order = "desc"
+			}
+			groupsort = append(groupsort, map[string]interface{}{name: map[string]interface{}{"order": order}})
+		}
+		if groupsort != nil {
+			terms["sort"] = groupsort
+		}
+		request["aggs"] = map[string]interface{}{q.GroupBy: terms}
+	}
+
+	opts, err := q.jsonOptions()
+	if err != nil {
+		return nil, err
+	}
+	request["options"] = opts
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(request); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func radToDeg(rad float32) float32 {
+	return float32(float64(rad) * 180 / math.Pi)
+}
+
+// jsonObject decodes JSON object, keeping the order of it's keys
+func jsonObject(data []byte) ([]string, map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected JSON object, got %s", data)
+	}
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := tok.(string)
+		var val json.RawMessage
+		if err = dec.Decode(&val); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = val
+	}
+	return keys, values, nil
+}
+
+// jsonMessage extracts text from error or warning, which may be either string, either object with 'reason'
+func jsonMessage(data json.RawMessage) string {
+	var str string
+	if json.Unmarshal(data, &str) == nil {
+		return str
+	}
+	var obj struct {
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(data, &obj) == nil && obj.Reason != "" {
+		return obj.Reason
+	}
+	return string(data)
+}
+
+// jsonColumnType chooses attribute type for JSON value; the same column may widen int to bigint, or uint32set to int64set
+func jsonColumnType(val json.RawMessage, prev EAttrType) EAttrType {
+	switch {
+	case len(val) == 0 || string(val) == "null":
+		return prev
+	case val[0] == '"':
+		return AttrString
+	case val[0] == '{':
+		return AttrJson
+	case string(val) == "true" || string(val) == "false":
+		return AttrBool
+	case val[0] == '[':
+		var values []json.Number
+		if json.Unmarshal(val, &values) != nil {
+			return AttrJson
+		}
+		tp := AttrUint32set
+		for _, num := range values {
+			if _, err := strconv.ParseUint(string(num), 10, 32); err == nil {
+				continue
+			}
+			if _, err := strconv.ParseInt(string(num), 10, 64); err != nil {
+				return AttrJson
+			}
+			tp = AttrInt64set
+		}
+		if prev == AttrInt64set {
+			return prev
+		}
+		return tp
+	}
+	if _, err := strconv.ParseUint(string(val), 10, 32); err == nil {
+		if prev == AttrBigint || prev == AttrFloat {
+			return prev
+		}
+		return AttrInteger
+	}
+	if _, err := strconv.ParseInt(string(val), 10, 64); err == nil {
+		if prev == AttrFloat {
+			return prev
+		}
+		return AttrBigint
+	}
+	return AttrFloat
+}
+
+// jsonValue converts JSON value to the same type as parseMatch would provide for attribute of type `tp`
+func jsonValue(val json.RawMessage, tp EAttrType) interface{} {
+	if len(val) == 0 || string(val) == "null" {
+		return nil
+	}
+	switch tp {
+	case AttrString:
+		var str string
+		if json.Unmarshal(val, &str) == nil {
+			return JsonOrStr{false, str}
+		}
+	case AttrBool:
+		if string(val) == "true" {
+			return uint32(1)
+		}
+		return uint32(0)
+	case AttrInteger:
+		num, _ := strconv.ParseUint(string(val), 10, 32)
+		return uint32(num)
+	case AttrBigint:
+		num, _ := strconv.ParseInt(string(val), 10, 64)
+		return uint64(num)
+	case AttrFloat:
+		num, _ := strconv.ParseFloat(string(val), 32)
+		return float32(num)
+	case AttrUint32set:
+		var values []uint32
+		_ = json.Unmarshal(val, &values)
+		return values
+	case AttrInt64set:
+		var values []int64
+		_ = json.Unmarshal(val, &values)
+		result := make([]uint64, len(values))
+		for i, v := range values {
+			result[i] = uint64(v)
+		}
+		return result
+	}
+	return JsonOrStr{true, string(val)}
+}
+
+/*
+ParseJSONResult decodes response of "json/search" endpoint (or HTTP /search) into QueryResult, to be used the same
+way as result of RunQuery(). Buckets of aggregations, if any, are returned in map by aggregation name.
+
+Since JSON response has no schema, attribute types are guessed from values: integers become AttrInteger
+(or AttrBigint, if any value doesn't fit into 32 bits), fractional numbers - AttrFloat, strings - AttrString,
+arrays of integers - AttrUint32set or AttrInt64set, and objects - AttrJson (provided as JsonOrStr with IsJson set).
+Attributes are ordered as in `_source` of the first hit. Values are of the same Go types as RunQuery() provides.
+
+Error reported by daemon in response is returned in Error field of the result, with StatusError status.
+*/
+func ParseJSONResult(data []byte) (*QueryResult, map[string][]FacetBucket, error) {
+	var resp struct {
+		Took     int64           `json:"took"`
+		TimedOut bool            `json:"timed_out"`
+		Error    json.RawMessage `json:"error"`
+		Warning  json.RawMessage `json:"warning"`
+		Hits     struct {
+			Total int `json:"total"`
+			Hits  []struct {
+				ID     json.Number     `json:"_id"`
+				Score  json.Number     `json:"_score"`
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations map[string]struct {
+			Buckets []struct {
+				Key      json.RawMessage `json:"key"`
+				DocCount int             `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&resp); err != nil {
+		return nil, nil, err
+	}
+
+	res := &QueryResult{Id64: true, QueryTime: time.Duration(resp.Took) * time.Millisecond}
+	if resp.Error != nil {
+		res.Status, res.Error = StatusError, jsonMessage(resp.Error)
+		return res, nil, nil
+	}
+	if resp.Warning != nil {
+		res.Status, res.Warning = StatusWarning, jsonMessage(resp.Warning)
+	}
+	if resp.TimedOut && res.Warning == "" {
+		res.Status, res.Warning = StatusWarning, "query timed out"
+	}
+	res.Total, res.TotalFound = resp.Hits.Total, resp.Hits.Total
+
+	// guess schema over all the hits
+	sources := make([]map[string]json.RawMessage, len(resp.Hits.Hits))
+	columns := make(map[string]int)
+	for j, hit := range resp.Hits.Hits {
+		if len(hit.Source) == 0 {
+			continue
+		}
+		keys, values, err := jsonObject(hit.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources[j] = values
+		for _, key := range keys {
+			idx, ok := columns[key]
+			if !ok {
+				idx = len(res.Attrs)
+				columns[key] = idx
+				res.Attrs = append(res.Attrs, ColumnInfo{key, AttrNone})
+			}
+			res.Attrs[idx].Type = jsonColumnType(values[key], res.Attrs[idx].Type)
+		}
+	}
+
+	res.Matches = make([]Match, len(resp.Hits.Hits))
+	for j, hit := range resp.Hits.Hits {
+		id, err := strconv.ParseUint(string(hit.ID), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid document id %s", hit.ID)
+		}
+		score, _ := hit.Score.Float64()
+		match := Match{DocID(id), int(score), make([]interface{}, len(res.Attrs))}
+		for i, col := range res.Attrs {
+			match.Attrs[i] = jsonValue(sources[j][col.Name], col.Type)
+		}
+		res.Matches[j] = match
+	}
+
+	var aggs map[string][]FacetBucket
+	if len(resp.Aggregations) != 0 {
+		aggs = make(map[string][]FacetBucket)
+		for name, agg := range resp.Aggregations {
+			buckets := make([]FacetBucket, len(agg.Buckets))
+			for i, bucket := range agg.Buckets {
+				buckets[i].Value = jsonValue(bucket.Key, jsonColumnType(bucket.Key, AttrNone))
+				if str, ok := buckets[i].Value.(JsonOrStr); ok {
+					buckets[i].Value = str.Val
+				}
+				buckets[i].Count = bucket.DocCount
+			}
+			aggs[name] = buckets
+		}
+	}
+	return res, aggs, nil
+}
+
+/*
+RunJSONQuery runs the search query through "json/search" endpoint, using ToJSONQuery() to build request, and
+ParseJSONResult() to decode the answer. Aggregation buckets (for group-by queries) are returned by attribute name.
+
+It is intended to check that JSON path gives the same results as RunQuery(), before moving to HTTP API.
+*/
+func (cl *Client) RunJSONQuery(q Search) (*QueryResult, map[string][]FacetBucket, error) {
+	request, err := q.ToJSONQuery()
+	if err != nil {
+		return nil, nil, err
+	}
+	answer, err := cl.Json("json/search", string(request))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ParseJSONResult([]byte(answer.Answer))
+}
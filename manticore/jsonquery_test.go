@@ -0,0 +1,160 @@
+package manticore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearch_ToJSONQuery(t *testing.T) {
+
+	q := NewSearch("hello", "lj, rt", "")
+	q.SelectClause = "title, price*2 as dprice"
+	q.AddFilter("gid", []int64{1}, false)
+	q.AddFilter("tag", []int64{2, 3}, true)
+	q.AddFilterRange("price", 10, 20, false)
+	q.AddFilterString("lang", "en", false)
+	q.AddFilterExpression("a>1 OR b<2", false)
+	q.SetGeoAnchorDegrees("lat", "lon", 45, 90)
+	q.WithinRadius(1000)
+	q.SortByDistance(false)
+	q.SetRankingMode(RankSph04)
+	q.Limit = 10
+
+	request, err := q.ToJSONQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"_source":["title","dprice"],"index":"lj,rt","limit":10,"offset":0,` +
+		`"options":{"max_matches":1000,"ranker":"sph04"},` +
+		`"query":{"bool":{"must":[{"query_string":"hello"},{"equals":{"gid":1}},{"range":{"price":{"gte":10,"lte":20}}},` +
+		`{"equals":{"lang":"en"}},{"equals":{"filter_1":1}},{"geo_distance":{"distance":"1000 m","distance_type":"adaptive",` +
+		`"location_anchor":{"lat":45,"lon":90},"location_source":"lat,lon"}}],` +
+		`"must_not":[{"in":{"tag":[2,3]}}]}},"script_fields":{"dprice":{"script":{"inline":"price*2"}},` +
+		`"filter_1":{"script":{"inline":"a>1 OR b<2"}},"geodist":{"script":{"inline":` +
+		`"GEODIST(lat, lon, 0.7853982, 1.5707964, {in=rad, out=m})"}}},"sort":[{"geodist":"asc"},{"_score":"desc"}]}`
+	if string(request) != expected {
+		t.Errorf("unexpected request:\n%s\nexpected:\n%s", request, expected)
+	}
+
+	q = NewSearch("", "lj", "")
+	q.SetGroupBy("gid", GroupbyAttr, "@count desc")
+	request, err = q.ToJSONQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"aggs":{"gid":{"sort":[{"count(*)":{"order":"desc"}}],"terms":{"field":"gid","size":1000}}},` +
+		`"index":"lj","limit":20,"offset":0,"options":{"max_matches":1000},"query":{"match_all":{}}}`
+	if string(request) != expected {
+		t.Errorf("unexpected request:\n%s\nexpected:\n%s", request, expected)
+	}
+
+	q.AddFilterNull("j", true)
+	if _, err = q.ToJSONQuery(); err == nil {
+		t.Error("expected error for null filter")
+	}
+	q = NewSearch("", "lj", "")
+	q.SetOuterSelect("id asc", 0, 10)
+	if _, err = q.ToJSONQuery(); err == nil {
+		t.Error("expected error for outer select")
+	}
+	q = NewSearch("", "lj", "")
+	q.SelectClause = "gid*2 as filter_1"
+	q.AddFilterExpression("gid>1", false)
+	if request, err = q.ToJSONQuery(); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"_source":["filter_1"],"index":"lj","limit":20,"offset":0,"options":{"max_matches":1000},` +
+		`"query":{"equals":{"filter_2":1}},` +
+		`"script_fields":{"filter_1":{"script":{"inline":"gid*2"}},"filter_2":{"script":{"inline":"gid>1"}}}}`
+	if string(request) != expected {
+		t.Errorf("unexpected request:\n%s\nexpected:\n%s", request, expected)
+	}
+}
+
+func TestParseJSONResult(t *testing.T) {
+
+	answer := `{"took":12,"timed_out":false,"hits":{"total":3,"total_relation":"eq","hits":[
+		{"_id":"1","_score":2500,"_source":{"title":"hello","gid":10,"price":1.5,"tags":[1,2],"j":{"a":1}}},
+		{"_id":2,"_score":1500,"_source":{"title":"world","gid":5000000000,"price":2,"tags":[],"j":null}}]},
+		"aggregations":{"gid":{"buckets":[{"key":10,"doc_count":2},{"key":"x","doc_count":1}]}}}`
+
+	res, aggs, err := ParseJSONResult([]byte(answer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := []ColumnInfo{{"title", AttrString}, {"gid", AttrBigint}, {"price", AttrFloat},
+		{"tags", AttrUint32set}, {"j", AttrJson}}
+	if !reflect.DeepEqual(res.Attrs, attrs) {
+		t.Errorf("unexpected schema %v", res.Attrs)
+	}
+	matches := []Match{
+		{1, 2500, []interface{}{JsonOrStr{false, "hello"}, uint64(10), float32(1.5), []uint32{1, 2}, JsonOrStr{true, `{"a":1}`}}},
+		{2, 1500, []interface{}{JsonOrStr{false, "world"}, uint64(5000000000), float32(2), []uint32{}, nil}},
+	}
+	if !reflect.DeepEqual(res.Matches, matches) {
+		t.Errorf("unexpected matches %v", res.Matches)
+	}
+	if res.TotalFound != 3 || res.QueryTime != 12*time.Millisecond || res.Status != StatusOk {
+		t.Errorf("unexpected result %v", res)
+	}
+	buckets := []FacetBucket{{uint32(10), 2}, {"x", 1}}
+	if !reflect.DeepEqual(aggs["gid"], buckets) {
+		t.Errorf("unexpected buckets %v", aggs)
+	}
+
+	res, _, err = ParseJSONResult([]byte(`{"error":{"type":"parse_error","reason":"unknown index 'foo'"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusError || res.Error != "unknown index 'foo'" {
+		t.Errorf("unexpected error result %v", res)
+	}
+
+	if _, _, err = ParseJSONResult([]byte(`not a json`)); err == nil {
+		t.Error("expected error for malformed answer")
+	}
+}
+
+func TestClient_RunJSONQuery(t *testing.T) {
+
+	cl := NewClient()
+	q := NewSearch("luther", "lj", "")
+	q.SelectClause = "id, channel_id"
+	q.AddFilterRange("channel_id", 1, 1000000, false)
+	q.SetSortMode(SortExtended, "channel_id desc, @id asc")
+
+	res, err := cl.RunQuery(q)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	jres, _, err := cl.RunJSONQuery(q)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if len(res.Matches) != len(jres.Matches) {
+		t.Errorf("binary and JSON queries returned %d and %d matches", len(res.Matches), len(jres.Matches))
+		return
+	}
+	for i := range res.Matches {
+		if res.Matches[i].DocID != jres.Matches[i].DocID {
+			t.Errorf("match %d: binary query returned doc %d, JSON - doc %d", i, res.Matches[i].DocID, jres.Matches[i].DocID)
+		}
+	}
+}
+
+func ExampleSearch_ToJSONQuery() {
+	q := NewSearch("hello", "lj", "")
+	q.AddFilter("gid", []int64{1, 2}, true)
+	request, _ := q.ToJSONQuery()
+
+	var pretty map[string]interface{}
+	_ = json.Unmarshal(request, &pretty)
+	fmt.Println(pretty["query"])
+	// Output:
+	// map[bool:map[must:[map[query_string:hello]] must_not:[map[in:map[gid:[1 2]]]]]]
+}
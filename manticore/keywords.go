@@ -17,17 +17,69 @@ func (kw Keyword) String() string {
 		kw.Querypos, kw.Docs, kw.Hits)
 }
 
-func buildKeywordsRequest(query, index string, hits bool) func(*apibuf) {
+/*
+KeywordsOptions used to tune BuildKeywordsEx() call.
+
+`Hits` - whether keyword occurrence statistics (docs/hits) are required.
+
+`FoldLemmas` - fold all the lemmas of the token into one entry.
+
+`FoldBlended` - fold blended parts of the token into one entry.
+
+`FoldWildcards` - fold all the expansions of wildcard (like 'hel*') into one entry, with summary statistics.
+
+Folded statistics are approximate: hits are summed over the folded forms, and docs is the max over them (documents
+which contain several forms can't be told apart). Daemon doesn't tell which kind of folding produced an entry, so
+with any fold flag set, all the subsequent entries of the same token are folded.
+
+`ExpansionLimit` - maximal number of expansions of one wildcard; 0 means limit from index settings.
+*/
+type KeywordsOptions struct {
+	Hits           bool
+	FoldLemmas     bool
+	FoldBlended    bool
+	FoldWildcards  bool
+	ExpansionLimit int32
+}
+
+func (opts *KeywordsOptions) folding() bool {
+	return opts.FoldLemmas || opts.FoldBlended || opts.FoldWildcards
+}
+
+func buildKeywordsRequest(query, index string, opts *KeywordsOptions) func(*apibuf) {
 	return func(buf *apibuf) {
 		buf.putString(query)
 		buf.putString(index)
-		buf.putBoolDword(hits)
+		buf.putBoolDword(opts.Hits)
+
+		buf.putBoolDword(opts.FoldLemmas)
+		buf.putBoolDword(opts.FoldBlended)
+		buf.putBoolDword(opts.FoldWildcards)
+		buf.putInt(opts.ExpansionLimit)
+	}
+}
 
-		buf.putBoolDword(false) // fixme! FoldLemmas
-		buf.putBoolDword(false) // fixme! FoldBlended
-		buf.putBoolDword(false) // fixme! FoldWildcards
-		buf.putDword(0) // fixme! ExpansionLimit
+// aggregateKeywords merges subsequent entries of the same token (same query position and tokenized form) into one.
+// Hits are summed, but docs are not, since a document may contain several forms: the max is taken, which is the lower
+// bound of the real number. If merged entries have different normalized forms, the token itself is used as
+// normalized form.
+func aggregateKeywords(keywords []Keyword) []Keyword {
+	var result []Keyword
+	for _, kw := range keywords {
+		last := len(result) - 1
+		if last >= 0 && result[last].Querypos == kw.Querypos && result[last].Tokenized == kw.Tokenized {
+			if result[last].Normalized != kw.Normalized {
+				result[last].Normalized = kw.Tokenized
+			}
+			if kw.Docs > result[last].Docs {
+				result[last].Docs = kw.Docs
+			}
+			result[last].Hits += kw.Hits
+			continue
+		}
+		result = append(result, kw)
 	}
+	return result
 }
 
 func parseKeywordsAnswer(hits bool) func(*apibuf) interface{} {
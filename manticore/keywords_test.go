@@ -2,6 +2,7 @@ package manticore
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -54,3 +55,51 @@ func ExampleClient_BuildKeywords_withHits() {
 	//  {Tok: 'query',	Norm: 'query',	Qpos: 4; docs/hits 1235/1474}
 	// ]
 }
+
+func TestBuildKeywordsRequest(t *testing.T) {
+
+	var buf apibuf
+	buildKeywordsRequest("hel*", "lj", &KeywordsOptions{true, false, true, true, 10})(&buf)
+
+	if buf.getString() != "hel*" || buf.getString() != "lj" {
+		t.Fatal("unexpected query or index")
+	}
+	flags := []uint32{buf.getDword(), buf.getDword(), buf.getDword(), buf.getDword()}
+	if flags[0] != 1 || flags[1] != 0 || flags[2] != 1 || flags[3] != 1 {
+		t.Errorf("unexpected flags %v", flags)
+	}
+	if limit := buf.getInt(); limit != 10 {
+		t.Errorf("unexpected expansion limit %d", limit)
+	}
+}
+
+func TestAggregateKeywords(t *testing.T) {
+
+	keywords := []Keyword{
+		{"running", "run", 1, 10, 20},
+		{"running", "running", 1, 5, 6},
+		{"hel*", "hel*", 2, 100, 150},
+		{"hel*", "hel*", 2, 1, 1},
+		{"running", "run", 3, 10, 20},
+	}
+	aggregated := aggregateKeywords(keywords)
+	expected := []Keyword{
+		{"running", "running", 1, 10, 26},
+		{"hel*", "hel*", 2, 100, 151},
+		{"running", "run", 3, 10, 20},
+	}
+	if !reflect.DeepEqual(aggregated, expected) {
+		t.Errorf("unexpected aggregation %v", aggregated)
+	}
+}
+
+func TestClient_BuildKeywordsEx(t *testing.T) {
+	cl := NewClient()
+
+	kwds, err := cl.BuildKeywordsEx("luth*", "lj", KeywordsOptions{Hits: true, FoldWildcards: true, ExpansionLimit: 5})
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(kwds)
+	}
+}
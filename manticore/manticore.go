@@ -58,6 +58,7 @@ package manticore
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -129,6 +130,19 @@ func (cl *Client) BuildExcerpts(docs []string, index,
 //
 // `hits` is a boolean flag that indicates whether keyword occurrence statistics are required.
 func (cl *Client) BuildKeywords(query, index string, hits bool) ([]Keyword, error) {
+	return cl.BuildKeywordsEx(query, index, KeywordsOptions{Hits: hits})
+}
+
+// BuildKeywordsEx works like BuildKeywords, but accepts all the options of the call, including folding of lemmas,
+// blended parts and wildcard expansions, and limit of expansions. See KeywordsOptions for details.
+//
+// When any folding is enabled, subsequent entries of the same token are merged into one with approximate summary
+// docs and hits, see KeywordsOptions.
+//
+// Usage example (autocomplete):
+//
+//  keywords, err := cl.BuildKeywordsEx("hel*", "lj", KeywordsOptions{Hits: true, FoldWildcards: true, ExpansionLimit: 10})
+func (cl *Client) BuildKeywordsEx(query, index string, opts KeywordsOptions) ([]Keyword, error) {
 
 	if query == "" {
 		return nil, errors.New("invalid arguments (query must not be empty)")
@@ -139,11 +153,14 @@ func (cl *Client) BuildKeywords(query, index string, hits bool) ([]Keyword, erro
 	}
 
 	keywords, err := cl.netQuery(commandKeywords,
-		buildKeywordsRequest(query, index, hits),
-		parseKeywordsAnswer(hits))
+		buildKeywordsRequest(query, index, &opts),
+		parseKeywordsAnswer(opts.Hits))
 	if keywords == nil {
 		return nil, err
 	}
+	if opts.folding() {
+		return aggregateKeywords(keywords.([]Keyword)), err
+	}
 	return keywords.([]Keyword), err
 }
 
@@ -299,6 +316,21 @@ func (cl *Client) RunQueries(queries []Search) ([]QueryResult, error) {
 		return nil, errors.New("no queries defined, issue AddQuery() first")
 	}
 
+	if cl.validate {
+		var problems SearchValidationError
+		for j := range queries {
+			if err, ok := queries[j].Validate().(SearchValidationError); ok {
+				for _, problem := range err {
+					problem.Field = fmt.Sprintf("[%d].%s", j, problem.Field)
+					problems = append(problems, problem)
+				}
+			}
+		}
+		if problems != nil {
+			return nil, problems
+		}
+	}
+
 	res, err := cl.netQuery(commandSearch,
 		buildSearchRequest(queries),
 		parseSearchAnswer(nreqs))
@@ -316,7 +348,28 @@ func (cl *Client) RunQueries(queries []Search) ([]QueryResult, error) {
 //
 // Each result set in the returned array is exactly the same as the result set returned from RunQuery.
 //
+// If result cache is attached to the client by SetCache(), results are taken from it when possible.
 func (cl *Client) RunQuery(query Search) (*QueryResult, error) {
+	if cl.validate {
+		if err := query.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cl.cache != nil {
+		server := fmt.Sprintf("%s:%s:%d", cl.dialmethod, cl.host, cl.port)
+		result, err := cl.cache.fetch(server, &query, func() (*QueryResult, error) {
+			return cl.runQuery(query)
+		})
+		if result != nil {
+			cl.lastWarning = result.Warning
+		}
+		return result, err
+	}
+	return cl.runQuery(query)
+}
+
+func (cl *Client) runQuery(query Search) (*QueryResult, error) {
 	res, err := cl.netQuery(commandSearch,
 		buildSearchRequest([]Search{query}),
 		parseSearchAnswer(1))
@@ -328,6 +381,20 @@ func (cl *Client) RunQuery(query Search) (*QueryResult, error) {
 	return &result, err
 }
 
+// SetCache attaches result cache to the client, so that RunQuery() returns cached results for repeated
+// identical queries. Pass nil to detach the cache. One cache may be shared by several clients.
+//
+// Usage example:
+//
+//  cache := NewResultCache(time.Minute, 1000)
+//  cl.SetCache(cache)
+//  res, err := cl.RunQuery(q) // goes to the daemon
+//  res, err = cl.RunQuery(q) // returned from cache
+//  cache.InvalidateIndex("products") // after products were updated
+func (cl *Client) SetCache(cache *ResultCache) {
+	cl.cache = cache
+}
+
 // SetConnectTimeout sets the time allowed to spend connecting to the server before giving up.
 //
 // Under some circumstances, the server can be delayed in responding, either due to network delays, or a query backlog.
@@ -384,6 +451,15 @@ func (cl *Client) SetServer(host string, port ...uint16) {
 	}
 }
 
+// SetValidation enables or disables client-side check of queries before sending them to the server.
+//
+// If enabled, RunQuery() and RunQueries() invoke Search.Validate() for every query, and return
+// SearchValidationError without sending anything if any problem found. For RunQueries() the names of the
+// fields are prefixed with the number of the query in the batch, as "[1].Limit". Disabled by default.
+func (cl *Client) SetValidation(validate bool) {
+	cl.validate = validate
+}
+
 /*
 Sphinxql send sphinxql request encapsulated into API.
 Return over network came in mysql native proto format, which is parsed by SDK and represented
@@ -404,6 +480,31 @@ func (cl *Client) Sphinxql(cmd string) ([]Sqlresult, error) {
 	return blob.([]Sqlresult), err
 }
 
+// sqlError is error reported by daemon for sphinxql statement, as opposed to failure of the request itself
+type sqlError struct {
+	code uint16
+	msg  SqlMsg
+}
+
+func (e sqlError) Error() string {
+	return fmt.Sprintf("ERROR %d %v", e.code, e.msg)
+}
+
+// sqlExec runs single sphinxql statement, and returns it's result, or error if statement failed.
+func (cl *Client) sqlExec(stmt string) (*Sqlresult, error) {
+	rss, err := cl.Sphinxql(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rss) == 0 {
+		return nil, errors.New("empty answer to sphinxql")
+	}
+	if rss[0].ErrorCode != 0 {
+		return nil, sqlError{rss[0].ErrorCode, rss[0].Msg}
+	}
+	return &rss[0], nil
+}
+
 /*
 Ping just send a uint32 cookie to the daemon and immediately receive it back.
 It may be used to average network responsibility time, or to ping if daemon is alive or not.
@@ -477,6 +578,9 @@ func (cl *Client) Status(global bool) (map[string]string, error) {
 // Here we update documents 1001, 1002 and 1003 in index products.
 // For document 1001, the new price will be set to 123 and the new amount in stock to 5;
 // for document 1002, the new price will be 37 and the new amount will be 11; etc.
+//
+// Values are validated before sending, and error is returned if any of them doesn't match `vtype`.
+// To update attributes of different types at once, use UpdateAttributesEx().
 func (cl *Client) UpdateAttributes(index string, attrs []string, values map[DocID][]interface{},
 	vtype EUpdateType, ignorenonexistent bool) (int, error) {
 
@@ -492,8 +596,17 @@ func (cl *Client) UpdateAttributes(index string, attrs []string, values map[DocI
 		return -1, errors.New("invalid arguments (values must not be empty)")
 	}
 
+	tattrs, err := updateAttrs(attrs, vtype)
+	if err != nil {
+		return -1, err
+	}
+	ids, checked, err := checkUpdateValues(tattrs, values)
+	if err != nil {
+		return -1, err
+	}
+
 	updated, err := cl.netQuery(commandUpdate,
-		buildUpdateRequest(index, attrs, values, vtype, ignorenonexistent),
+		buildUpdateRequest(index, tattrs, ids, checked, ignorenonexistent),
 		parseDwordAnswer())
 	if updated == nil {
 		return -1, err
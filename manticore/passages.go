@@ -0,0 +1,192 @@
+package manticore
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SnippetSegment is a piece of passage text, either highlighted (matched keywords) or not.
+//
+// `Start`, `End` are byte offsets of the segment in the source document, and `RuneStart`, `RuneEnd` - the same in
+// runes. They are -1 if the passage was not found in the document as is (say, because of html stripping).
+type SnippetSegment struct {
+	Text               string
+	Highlighted        bool
+	Start, End         int
+	RuneStart, RuneEnd int
+}
+
+// SnippetPassage is one passage of the snippet. `ID` is the value of %PASSAGE_ID% macro for the passage (counted from
+// SnippetOptions.StartPassageId), or 0 if the passage has no highlighted segments. `Start`, `End`,
+// `RuneStart` and `RuneEnd` are offsets of the whole passage in the document, as in SnippetSegment.
+type SnippetPassage struct {
+	ID                 int
+	Segments           []SnippetSegment
+	Start, End         int
+	RuneStart, RuneEnd int
+}
+
+// Text returns text of the passage without any highlighting.
+func (p SnippetPassage) Text() string {
+	var text string
+	for _, seg := range p.Segments {
+		text += seg.Text
+	}
+	return text
+}
+
+// snippetMarkers are unique strings which SDK uses as before/after match and chunk separator
+type snippetMarkers struct {
+	mark, before, after, separator string
+}
+
+// chooseSnippetMarkers picks private-use code point which occurs neither in documents, nor in words, and builds
+// markers from it.
+func chooseSnippetMarkers(docs []string, words string) (snippetMarkers, error) {
+	for mark := rune(0xE000); mark <= 0xF8FF; mark++ {
+		str := string(mark)
+		if strings.Contains(words, str) {
+			continue
+		}
+		used := false
+		for _, doc := range docs {
+			if strings.Contains(doc, str) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return snippetMarkers{str, str + "b%PASSAGE_ID%" + str, str + "e" + str, str + "s" + str}, nil
+		}
+	}
+	return snippetMarkers{}, errors.New("can't choose unique snippet markers")
+}
+
+// runeOffset converts byte offset in str into rune offset
+func runeOffset(str string, offset int) int {
+	return utf8.RuneCountInString(str[:offset])
+}
+
+// parsePassages splits snippet, built with markers `m`, into passages with segments, and locates them in `doc`.
+// Search of passage starts after the previous one, so the same text in different places is not confused
+// (unless passages are in weight order).
+func parsePassages(snippet, doc string, m snippetMarkers) []SnippetPassage {
+	mark := m.mark
+	beforePrefix := mark + "b"
+
+	var passages []SnippetPassage
+	cursor := 0
+	for _, chunk := range strings.Split(snippet, m.separator) {
+		if chunk == "" {
+			continue
+		}
+		var passage SnippetPassage
+		for chunk != "" {
+			begin := strings.Index(chunk, beforePrefix)
+			if begin < 0 {
+				passage.Segments = append(passage.Segments, SnippetSegment{Text: chunk})
+				break
+			}
+			if begin > 0 {
+				passage.Segments = append(passage.Segments, SnippetSegment{Text: chunk[:begin]})
+			}
+			chunk = chunk[begin+len(beforePrefix):]
+			idEnd := strings.Index(chunk, mark)
+			if idEnd < 0 {
+				passage.Segments = append(passage.Segments, SnippetSegment{Text: chunk})
+				break
+			}
+			if id, err := strconv.Atoi(chunk[:idEnd]); err == nil && passage.ID == 0 {
+				passage.ID = id
+			}
+			chunk = chunk[idEnd+len(mark):]
+			end := strings.Index(chunk, m.after)
+			if end < 0 {
+				end = len(chunk)
+			}
+			passage.Segments = append(passage.Segments, SnippetSegment{Text: chunk[:end], Highlighted: true})
+			chunk = chunk[end:]
+			if strings.HasPrefix(chunk, m.after) {
+				chunk = chunk[len(m.after):]
+			}
+		}
+
+		text := passage.Text()
+		start := strings.Index(doc[cursor:], text)
+		if start >= 0 {
+			start += cursor
+		} else {
+			start = strings.Index(doc, text)
+		}
+		if start < 0 || text == "" {
+			passage.Start, passage.End, passage.RuneStart, passage.RuneEnd = -1, -1, -1, -1
+			for i := range passage.Segments {
+				seg := &passage.Segments[i]
+				seg.Start, seg.End, seg.RuneStart, seg.RuneEnd = -1, -1, -1, -1
+			}
+		} else {
+			cursor = start + len(text)
+			passage.Start, passage.End = start, cursor
+			passage.RuneStart = runeOffset(doc, start)
+			passage.RuneEnd = passage.RuneStart + utf8.RuneCountInString(text)
+			offset, runes := start, passage.RuneStart
+			for i := range passage.Segments {
+				seg := &passage.Segments[i]
+				seg.Start, seg.RuneStart = offset, runes
+				offset += len(seg.Text)
+				runes += utf8.RuneCountInString(seg.Text)
+				seg.End, seg.RuneEnd = offset, runes
+			}
+		}
+		passages = append(passages, passage)
+	}
+	return passages
+}
+
+/*
+BuildPassages works like BuildExcerpts, but returns structured snippets instead of plain strings. For every document
+it returns the list of passages, each one as a list of text segments flagged as highlighted or not, with passage id
+and offsets into the source document.
+
+Internally it replaces BeforeMatch, AfterMatch and ChunkSeparator of `opts` with unique markers (private-use
+characters which don't occur in the documents), and then splits the snippets by them. So rendering doesn't depend on
+any tags, and the text itself is never confused with highlighting.
+
+Usage example:
+
+  passages, err := cl.BuildPassages([]string{"hello world"}, "lj", "world")
+  if err == nil {
+    for _, seg := range passages[0][0].Segments {
+      fmt.Println(seg.Text, seg.Highlighted, seg.Start, seg.End)
+    }
+  }
+*/
+func (cl *Client) BuildPassages(docs []string, index, words string, opts ...SnippetOptions) ([][]SnippetPassage, error) {
+	var popts SnippetOptions
+	if len(opts) > 0 {
+		popts = opts[0]
+	} else {
+		popts = *NewSnippetOptions()
+	}
+	if popts.Flags&ExcerptFlagLoadFiles != 0 {
+		return nil, errors.New("invalid arguments (structured snippets can't be built from files)")
+	}
+
+	markers, err := chooseSnippetMarkers(docs, words)
+	if err != nil {
+		return nil, err
+	}
+	popts.BeforeMatch, popts.AfterMatch, popts.ChunkSeparator = markers.before, markers.after, markers.separator
+
+	snippets, err := cl.BuildExcerpts(docs, index, words, popts)
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]SnippetPassage, len(snippets))
+	for i, snippet := range snippets {
+		result[i] = parsePassages(snippet, docs[i], markers)
+	}
+	return result, nil
+}
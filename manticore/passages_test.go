@@ -0,0 +1,75 @@
+package manticore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePassages(t *testing.T) {
+
+	doc := "Привет, world! The quick brown fox jumps over the lazy dog. Another fox here."
+	m, err := chooseSnippetMarkers([]string{doc}, "fox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hl := func(id int, word string) string {
+		return m.mark + "b" + fmt.Sprint(id) + m.mark + word + m.after
+	}
+	snippet := m.separator + "The quick brown " + hl(1, "fox") + " jumps" + m.separator +
+		"Another " + hl(2, "fox") + " here." + m.separator
+
+	passages := parsePassages(snippet, doc, m)
+	if len(passages) != 2 {
+		t.Fatalf("expected 2 passages, got %v", passages)
+	}
+	first := passages[0]
+	if first.ID != 1 || len(first.Segments) != 3 || first.Text() != "The quick brown fox jumps" {
+		t.Errorf("unexpected first passage %+v", first)
+	}
+	fox := first.Segments[1]
+	if !fox.Highlighted || fox.Text != "fox" || doc[fox.Start:fox.End] != "fox" {
+		t.Errorf("unexpected highlighted segment %+v", fox)
+	}
+	if []rune(doc)[fox.RuneStart] != 'f' || fox.RuneEnd-fox.RuneStart != 3 || fox.Start-fox.RuneStart != 6 {
+		t.Errorf("unexpected rune offsets %+v", fox)
+	}
+	second := passages[1]
+	if second.ID != 2 || doc[second.Start:second.End] != "Another fox here." || doc[second.Segments[1].Start:second.Segments[1].End] != "fox" {
+		t.Errorf("unexpected second passage %+v", second)
+	}
+
+	// text which is not in document as is
+	passages = parsePassages("stripped "+hl(1, "fox"), doc, m)
+	if len(passages) != 1 || passages[0].Start != -1 || passages[0].Segments[1].End != -1 {
+		t.Errorf("expected unknown offsets, got %+v", passages)
+	}
+
+	// passage without highlighting
+	passages = parsePassages("Привет, world!", doc, m)
+	if len(passages) != 1 || passages[0].ID != 0 || passages[0].Start != 0 || passages[0].RuneEnd != 14 {
+		t.Errorf("unexpected plain passage %+v", passages)
+	}
+}
+
+func TestChooseSnippetMarkers(t *testing.T) {
+
+	m, err := chooseSnippetMarkers([]string{"doc with  inside"}, "words ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.mark != "" {
+		t.Errorf("expected marker not used in docs and words, got %q", m.mark)
+	}
+}
+
+func TestClient_BuildPassages(t *testing.T) {
+
+	cl := NewClient()
+	passages, err := cl.BuildPassages([]string{"this is my test text to be highlighted", "another test text"},
+		"lj", "test text")
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(passages)
+	}
+}
@@ -0,0 +1,318 @@
+package manticore
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PercolateEvent is emitted by Percolator for every document which matched one or more stored queries.
+// `Tags` are tags of the matched queries, in the same order as `QueryIDs`; they are filled only if
+// PercolatorOptions.PqOptions has NeedQuery flag.
+type PercolateEvent struct {
+	Doc      interface{}
+	QueryIDs []uint64
+	Tags     []string
+}
+
+// PercolatorOptions used to tune Percolator. All fields are exported and have meaning described below.
+//
+// BatchDocs
+//
+// Max number of documents sent in one CALL PQ request.
+//
+// Latency
+//
+// Max time the first document of the batch waits for others, before the batch is sent incomplete.
+//
+// InFlight
+//
+// Max number of requests processed at the same time, each over it's own connection. When all of them are busy,
+// Percolator stops reading the input channel (back-pressure).
+//
+// PqOptions
+//
+// Options of CALL PQ, as for CallPQDocs(). IdAlias and Shift are not used, since Percolator maps matches to the
+// documents itself.
+//
+// TextField
+//
+// Documents are percolated as JSON, as CallPQDocs() does, so strings must be JSON objects. If TextField is set,
+// strings which are not JSON objects are taken as plain text, and sent as {"<TextField>": text}. Otherwise such
+// documents fail the whole batch.
+//
+// OnError
+//
+// Called with documents of the failed batch and the error. Called from the request goroutines, so it must be safe
+// for concurrent use. If nil, errors are ignored.
+type PercolatorOptions struct {
+	BatchDocs int
+	Latency   time.Duration
+	InFlight  int
+	PqOptions SearchPqOptions
+	TextField string
+	OnError   func(docs []interface{}, err error)
+}
+
+// Create default PercolatorOptions with following defaults:
+//
+//  BatchDocs: 100
+//  Latency: 50ms
+//  InFlight: 2
+//  PqOptions: NewSearchPqOptions()
+//  TextField: ""
+//  OnError: nil
+func NewPercolatorOptions() *PercolatorOptions {
+	res := PercolatorOptions{
+		100,
+		50 * time.Millisecond,
+		2,
+		NewSearchPqOptions(),
+		"",
+		nil,
+	}
+	return &res
+}
+
+/*
+Percolator matches continuous stream of documents against percolate index. Documents are read from the input
+channel, collected into batches by count and latency, and sent by CallPQDocs() with several requests in flight.
+Matches are emitted to the output channel, one event per matched document. Events of different batches may come
+out of order of the input.
+
+The output channel is closed when the input channel is closed or Stop() is called, and all the read documents are
+processed (drained). The caller must keep reading events until then, otherwise Percolator blocks.
+
+Usage example:
+
+  cl := NewClient()
+  opts := NewPercolatorOptions()
+  opts.TextField = "title" // docs may be plain text
+  p := NewPercolator(&cl, "pq", *opts)
+  events := p.Run(docs) // docs is chan interface{} fed by the caller
+  for ev := range events {
+    fmt.Println(ev.Doc, "matched", ev.QueryIDs)
+  }
+*/
+type Percolator struct {
+	index   string
+	opts    PercolatorOptions
+	clients chan *Client
+	call    func(cl *Client, docs []interface{}) ([]PqMatch, error)
+	exec    func(cl *Client, stmt string) (*Sqlresult, error)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	requests sync.WaitGroup
+}
+
+/*
+NewPercolator creates percolator over percolate index `index` of the daemon `cl` is set to. Client itself is not
+used for requests, instead every request in flight uses it's own persistent connection with the same settings.
+
+`opts` is an optional struct PercolatorOptions, it may be created by calling NewPercolatorOptions() and then tuned.
+If `opts` is omitted, default will be used.
+*/
+func NewPercolator(cl *Client, index string, opts ...PercolatorOptions) *Percolator {
+	var popts PercolatorOptions
+	if len(opts) > 0 {
+		popts = opts[0]
+	} else {
+		popts = *NewPercolatorOptions()
+	}
+	if popts.BatchDocs <= 0 {
+		popts.BatchDocs = 1
+	}
+	if popts.InFlight <= 0 {
+		popts.InFlight = 1
+	}
+	popts.PqOptions.IdAlias, popts.PqOptions.Shift = "", 0
+
+	p := &Percolator{
+		index:   index,
+		opts:    popts,
+		clients: make(chan *Client, popts.InFlight),
+		stop:    make(chan struct{}),
+	}
+	for i := 0; i < popts.InFlight; i++ {
+		worker := cl.clone()
+		p.clients <- &worker
+	}
+	p.call = p.percolate
+	p.exec = func(worker *Client, stmt string) (*Sqlresult, error) {
+		for attempt := 0; ; attempt++ {
+			if !worker.connected {
+				if _, err := worker.Open(); err != nil {
+					return nil, err
+				}
+			}
+			rs, err := worker.sqlExec(stmt)
+			if err != nil && worker.connected && brokenConnection(err) {
+				_, _ = worker.Close()
+			}
+			// connection might be closed by daemon while idle; CALL PQ changes nothing, so just send it again
+			if err == nil || attempt > 0 || !networkError(err) {
+				return rs, err
+			}
+		}
+	}
+	return p
+}
+
+// percolate sends batch of documents over the worker's connection, as CallPQDocs() does
+func (p *Percolator) percolate(worker *Client, docs []interface{}) ([]PqMatch, error) {
+	stmt, _, err := pqDocsStatement(p.index, p.jsonDocs(docs), p.opts.PqOptions)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := p.exec(worker, stmt)
+	if err != nil {
+		return nil, err
+	}
+	return parsePqMatches(rs, docs, p.opts.PqOptions, nil)
+}
+
+// jsonDocs wraps plain-text documents into JSON objects with TextField, if it is set
+func (p *Percolator) jsonDocs(docs []interface{}) []interface{} {
+	if p.opts.TextField == "" {
+		return docs
+	}
+	res := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		res[i] = doc
+		if text, ok := doc.(string); ok {
+			if !strings.HasPrefix(strings.TrimSpace(text), "{") || !json.Valid([]byte(text)) {
+				res[i] = map[string]string{p.opts.TextField: text}
+			}
+		}
+	}
+	return res
+}
+
+// Run starts reading documents from `in`, and returns channel of match events. It must be called only once.
+func (p *Percolator) Run(in <-chan interface{}) <-chan PercolateEvent {
+	out := make(chan PercolateEvent, p.opts.BatchDocs)
+	go p.batcher(in, out)
+	return out
+}
+
+// Stop makes percolator stop reading the input. Documents already read are processed, and then the output channel
+// is closed. Stop doesn't wait for that, read the output until it is closed instead.
+func (p *Percolator) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// batcher collects documents from the input into batches, and sends them when batch is full or latency expired
+func (p *Percolator) batcher(in <-chan interface{}, out chan<- PercolateEvent) {
+	var batch []interface{}
+	var timer *time.Timer
+	var expired <-chan time.Time
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+		if len(batch) > 0 {
+			p.send(batch, out)
+			batch = nil
+		}
+	}
+
+	for {
+		// stop has priority over the input which is ready as well
+		select {
+		case <-p.stop:
+			flush()
+			p.drain(out)
+			return
+		default:
+		}
+
+		select {
+		case doc, ok := <-in:
+			if !ok {
+				flush()
+				p.drain(out)
+				return
+			}
+			batch = append(batch, doc)
+			if len(batch) == 1 && p.opts.Latency > 0 {
+				timer = time.NewTimer(p.opts.Latency)
+				expired = timer.C
+			}
+			if len(batch) >= p.opts.BatchDocs || p.opts.Latency <= 0 {
+				flush()
+			}
+		case <-expired:
+			timer, expired = nil, nil
+			flush()
+		case <-p.stop:
+			flush()
+			p.drain(out)
+			return
+		}
+	}
+}
+
+// send waits for free connection (which limits number of requests in flight), and processes the batch with it
+func (p *Percolator) send(docs []interface{}, out chan<- PercolateEvent) {
+	cl := <-p.clients
+	p.requests.Add(1)
+	go func() {
+		defer p.requests.Done()
+		matches, err := p.call(cl, docs)
+		p.clients <- cl
+		if err != nil {
+			if p.opts.OnError != nil {
+				p.opts.OnError(docs, err)
+			}
+			return
+		}
+		for _, ev := range percolateEvents(docs, matches) {
+			out <- ev
+		}
+	}()
+}
+
+// drain waits for all the requests in flight, closes the output and connections
+func (p *Percolator) drain(out chan<- PercolateEvent) {
+	p.requests.Wait()
+	close(out)
+	for i := 0; i < p.opts.InFlight; i++ {
+		cl := <-p.clients
+		if cl.connected {
+			_, _ = cl.Close()
+		}
+	}
+}
+
+// percolateEvents inverts matches of queries into events of documents, in the order of `docs`
+func percolateEvents(docs []interface{}, matches []PqMatch) []PercolateEvent {
+	events := make([]*PercolateEvent, len(docs))
+	for _, match := range matches {
+		for _, ordinal := range match.Ordinals {
+			pos := ordinal - 1
+			if pos < 0 || pos >= len(docs) {
+				continue
+			}
+			ev := events[pos]
+			if ev == nil {
+				ev = &PercolateEvent{Doc: docs[pos]}
+				events[pos] = ev
+			}
+			ev.QueryIDs = append(ev.QueryIDs, match.QueryID)
+			if match.Query.Flags&TagsPresent != 0 {
+				ev.Tags = append(ev.Tags, match.Query.Tags)
+			}
+		}
+	}
+	var result []PercolateEvent
+	for _, ev := range events {
+		if ev != nil {
+			result = append(result, *ev)
+		}
+	}
+	return result
+}
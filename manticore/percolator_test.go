@@ -0,0 +1,247 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePercolate matches query 1 (tagged "alert") with every doc containing "angry"
+func fakePercolate(cl *Client, docs []interface{}) ([]PqMatch, error) {
+	match := PqMatch{QueryID: 1, Query: PqQuery{Flags: TagsPresent, Tags: "alert"}}
+	for i, doc := range docs {
+		if strings.Contains(fmt.Sprint(doc), "angry") {
+			match.Ordinals = append(match.Ordinals, i+1)
+		}
+	}
+	if match.Ordinals == nil {
+		return nil, nil
+	}
+	return []PqMatch{match}, nil
+}
+
+func TestPercolateEvents(t *testing.T) {
+
+	docs := []interface{}{"a", "b", "c"}
+	events := percolateEvents(docs, []PqMatch{
+		{QueryID: 1, Ordinals: []int{3, 1}},
+		{QueryID: 2, Ordinals: []int{3, 7}, Query: PqQuery{Flags: TagsPresent, Tags: "x"}},
+	})
+	expected := []PercolateEvent{{"a", []uint64{1}, nil}, {"c", []uint64{1, 2}, []string{"x"}}}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func TestPercolator_batches(t *testing.T) {
+
+	var mu sync.Mutex
+	var sizes []int
+
+	opts := NewPercolatorOptions()
+	opts.BatchDocs = 3
+	opts.Latency = time.Hour
+	opts.InFlight = 1
+	cl := NewClient()
+	p := NewPercolator(&cl, "pq", *opts)
+	p.call = func(cl *Client, docs []interface{}) ([]PqMatch, error) {
+		mu.Lock()
+		sizes = append(sizes, len(docs))
+		mu.Unlock()
+		return fakePercolate(cl, docs)
+	}
+
+	in := make(chan interface{})
+	events := p.Run(in)
+	go func() {
+		for _, doc := range []string{"angry 1", "calm 2", "angry 3", "calm 4", "calm 5", "calm 6", "angry 7"} {
+			in <- doc
+		}
+		close(in)
+	}()
+
+	var docs []string
+	for ev := range events {
+		docs = append(docs, ev.Doc.(string))
+		if !reflect.DeepEqual(ev.QueryIDs, []uint64{1}) || !reflect.DeepEqual(ev.Tags, []string{"alert"}) {
+			t.Errorf("unexpected event %v", ev)
+		}
+	}
+	if !reflect.DeepEqual(docs, []string{"angry 1", "angry 3", "angry 7"}) {
+		t.Errorf("unexpected matched docs %v", docs)
+	}
+	if !reflect.DeepEqual(sizes, []int{3, 3, 1}) {
+		t.Errorf("unexpected batches %v", sizes)
+	}
+}
+
+func TestPercolator_latency(t *testing.T) {
+
+	opts := NewPercolatorOptions()
+	opts.Latency = 10 * time.Millisecond
+	cl := NewClient()
+	p := NewPercolator(&cl, "pq", *opts)
+	p.call = fakePercolate
+
+	in := make(chan interface{})
+	events := p.Run(in)
+	in <- "angry"
+	select {
+	case ev := <-events:
+		if ev.Doc != "angry" {
+			t.Errorf("unexpected event %v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("incomplete batch was not sent after latency")
+	}
+
+	p.Stop()
+	p.Stop() // repeated stop is harmless
+	for range events {
+	}
+}
+
+func TestPercolator_inflight(t *testing.T) {
+
+	var mu sync.Mutex
+	var running, peak int
+	var failed []string
+
+	opts := NewPercolatorOptions()
+	opts.BatchDocs = 1
+	opts.InFlight = 2
+	opts.OnError = func(docs []interface{}, err error) {
+		mu.Lock()
+		failed = append(failed, fmt.Sprint(docs[0]))
+		mu.Unlock()
+	}
+	cl := NewClient()
+	p := NewPercolator(&cl, "pq", *opts)
+	p.call = func(cl *Client, docs []interface{}) ([]PqMatch, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if docs[0] == "bad" {
+			return nil, errors.New("failure")
+		}
+		return fakePercolate(cl, docs)
+	}
+
+	in := make(chan interface{}, 10)
+	for _, doc := range []string{"angry 1", "bad", "angry 2", "angry 3", "calm", "angry 4"} {
+		in <- doc
+	}
+	close(in)
+
+	var docs []string
+	for ev := range p.Run(in) {
+		docs = append(docs, ev.Doc.(string))
+	}
+	sort.Strings(docs)
+	if !reflect.DeepEqual(docs, []string{"angry 1", "angry 2", "angry 3", "angry 4"}) {
+		t.Errorf("unexpected matched docs %v", docs)
+	}
+	if peak > 2 {
+		t.Errorf("%d requests in flight, limit is 2", peak)
+	}
+	if !reflect.DeepEqual(failed, []string{"bad"}) {
+		t.Errorf("unexpected failed docs %v", failed)
+	}
+}
+
+func TestPercolator_statement(t *testing.T) {
+
+	var stmts []string
+	opts := NewPercolatorOptions()
+	opts.TextField = "title"
+	cl := NewClient()
+	p := NewPercolator(&cl, "pq", *opts)
+	p.exec = func(cl *Client, stmt string) (*Sqlresult, error) {
+		stmts = append(stmts, stmt)
+		return &Sqlresult{
+			Schema: SqlSchema{{"id", 0, colLonglong, true}, {"documents", 0, colString, false}},
+			Rows:   SqlResultset{{uint64(1), "1,3"}},
+		}, nil
+	}
+
+	docs := []interface{}{"angry text", `{"title":"angry json","gid":3}`, map[string]interface{}{"title": "angry"}}
+	matches, err := p.call(&cl, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `CALL PQ('pq', ('{"title":"angry text"}', '{"title":"angry json","gid":3}', '{"title":"angry"}'), ` +
+		`1 AS docs, 1 AS docs_json, 0 AS query, 0 AS skip_bad_json, 0 AS shift)`
+	if len(stmts) != 1 || stmts[0] != expected {
+		t.Errorf("unexpected statement %q", stmts)
+	}
+	if len(matches) != 1 || !reflect.DeepEqual(matches[0].Ordinals, []int{1, 3}) ||
+		!reflect.DeepEqual(matches[0].Docs, []interface{}{docs[0], docs[2]}) {
+		t.Errorf("unexpected matches %v", matches)
+	}
+
+	p.opts.TextField = ""
+	if _, err = p.call(&cl, docs); err == nil {
+		t.Error("error expected for plain-text doc without TextField")
+	}
+}
+
+func TestPercolator_brokenConnection(t *testing.T) {
+
+	d := newFakeDaemon(t)
+	defer d.Close()
+
+	cl := d.client()
+	p := NewPercolator(&cl, "pq")
+	worker := <-p.clients
+	if _, err := p.exec(worker, "CALL PQ('pq', '{}')"); err != nil {
+		t.Fatal(err)
+	}
+	_ = (<-d.conns).Close()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := p.exec(worker, "CALL PQ('pq', '{}')"); err != nil {
+		t.Errorf("request over broken connection was not repeated: %v", err)
+	}
+	if len(d.statements()) != 2 || !worker.connected {
+		t.Errorf("unexpected statements %q", d.statements())
+	}
+	_, _ = worker.Close()
+}
+
+func TestPercolator_stopFirst(t *testing.T) {
+
+	var mu sync.Mutex
+	calls := 0
+	opts := NewPercolatorOptions()
+	opts.BatchDocs = 1
+	cl := NewClient()
+	p := NewPercolator(&cl, "pq", *opts)
+	p.call = func(cl *Client, docs []interface{}) ([]PqMatch, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return nil, nil
+	}
+
+	in := make(chan interface{}, 100)
+	for i := 0; i < 100; i++ {
+		in <- "doc"
+	}
+	p.Stop()
+	for range p.Run(in) {
+	}
+	if calls != 0 || len(in) != 100 {
+		t.Errorf("input was read after stop: %d calls, %d docs left", calls, len(in))
+	}
+}
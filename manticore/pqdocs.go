@@ -0,0 +1,203 @@
+package manticore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+PqMatch is one stored query matched by CallPQDocs(), with documents it matched.
+
+Ordinals
+
+Numbers of matched documents as daemon reports them: 1-based positions in the docs, plus SearchPqOptions.Shift.
+Empty if IdAlias is used.
+
+DocIDs
+
+Values of IdAlias field of matched documents. Empty if IdAlias is not used.
+
+Docs
+
+Matched documents themselves, as they were passed to CallPQDocs().
+
+Query
+
+Stored query, it's tags and filters. Filled only if NeedQuery flag was set.
+*/
+type PqMatch struct {
+	QueryID  uint64
+	Ordinals []int
+	DocIDs   []uint64
+	Docs     []interface{}
+	Query    PqQuery
+}
+
+// pqDocument encodes document as JSON. Strings, []byte and json.RawMessage are taken as already encoded JSON.
+func pqDocument(doc interface{}) ([]byte, error) {
+	switch v := doc.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	}
+	return json.Marshal(doc)
+}
+
+// pqDocumentID extracts id from `alias` field of JSON document
+func pqDocumentID(blob []byte, alias string) (uint64, error) {
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(blob))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return 0, err
+	}
+	value, ok := fields[alias]
+	if !ok {
+		return 0, fmt.Errorf("no '%s' field", alias)
+	}
+	id, err := strconv.ParseUint(fmt.Sprint(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("field '%s' is not an unsigned integer", alias)
+	}
+	return id, nil
+}
+
+// pqDocsStatement builds CALL PQ statement with json documents. Returns also map of document ids to positions in
+// `docs`, if IdAlias is set.
+func pqDocsStatement(index string, docs []interface{}, opts SearchPqOptions) (string, map[uint64]int, error) {
+	skipBad := opts.Flags&SkipBadJson != 0
+	var ids map[uint64]int
+	if opts.IdAlias != "" {
+		ids = make(map[uint64]int, len(docs))
+	}
+	values := make([]string, len(docs))
+	for i, doc := range docs {
+		blob, err := pqDocument(doc)
+		if err == nil && !json.Valid(blob) {
+			err = errors.New("invalid JSON")
+		}
+		if err == nil && ids != nil {
+			var id uint64
+			if id, err = pqDocumentID(blob, opts.IdAlias); err == nil {
+				ids[id] = i
+			}
+		}
+		if err != nil && !skipBad {
+			return "", nil, fmt.Errorf("doc %d: %v", i, err)
+		}
+		values[i] = quoteSQLString(string(blob))
+	}
+
+	stmt := fmt.Sprintf("CALL PQ(%s, ", quoteSQLString(index))
+	if len(values) == 1 {
+		stmt += values[0]
+	} else {
+		stmt += "(" + strings.Join(values, ", ") + ")"
+	}
+	stmt += fmt.Sprintf(", 1 AS docs, 1 AS docs_json, %d AS query, %d AS skip_bad_json, %d AS shift",
+		boolInt(opts.Flags&NeedQuery != 0), boolInt(skipBad), opts.Shift)
+	if opts.IdAlias != "" {
+		stmt += ", " + quoteSQLString(opts.IdAlias) + " AS docs_id"
+	}
+	return stmt + ")", ids, nil
+}
+
+// parsePqMatches decodes result of CALL PQ, and maps matched documents back to `docs`
+func parsePqMatches(rs *Sqlresult, docs []interface{}, opts SearchPqOptions, ids map[uint64]int) ([]PqMatch, error) {
+	id, documents, query, tags, filters := -1, -1, -1, -1, -1
+	for i, col := range rs.Schema {
+		switch col.Name {
+		case "id":
+			id = i
+		case "documents":
+			documents = i
+		case "query":
+			query = i
+		case "tags":
+			tags = i
+		case "filters":
+			filters = i
+		}
+	}
+	if id < 0 {
+		return nil, errors.New("no 'id' column in answer")
+	}
+
+	matches := make([]PqMatch, len(rs.Rows))
+	for j, row := range rs.Rows {
+		match := &matches[j]
+		match.QueryID, _ = strconv.ParseUint(fmt.Sprint(row[id]), 10, 64)
+		if documents >= 0 {
+			for _, item := range strings.Split(fmt.Sprint(row[documents]), ",") {
+				num, err := strconv.ParseUint(strings.TrimSpace(item), 10, 64)
+				if err != nil {
+					continue
+				}
+				if ids != nil {
+					match.DocIDs = append(match.DocIDs, num)
+					if pos, ok := ids[num]; ok {
+						match.Docs = append(match.Docs, docs[pos])
+					}
+				} else {
+					match.Ordinals = append(match.Ordinals, int(num))
+					if pos := int(num) - int(opts.Shift) - 1; pos >= 0 && pos < len(docs) {
+						match.Docs = append(match.Docs, docs[pos])
+					}
+				}
+			}
+		}
+		match.Query = pqQueryFromRow(row, query, tags, filters)
+	}
+	return matches, nil
+}
+
+/*
+CallPQDocs works like CallPQ, but percolates structured documents. Every document is encoded as JSON (strings,
+[]byte and json.RawMessage are taken as already encoded JSON), so it may carry attributes which stored filters use.
+
+For every matched stored query it returns the matched documents themselves, together with their numbers (with
+`opts.Shift` applied), or, if `opts.IdAlias` is set, with values of that field of the documents (documents must
+have it then). NeedDocs flag is implied. With SkipBadJson documents which can't be encoded are not an error.
+
+It works via CALL PQ, so meta-information which CallPQ returns with Verbose flag is not available.
+
+Usage example:
+
+  type Doc struct {
+    ID    uint64 `json:"id"`
+    Title string `json:"title"`
+    Gid   int    `json:"gid"`
+  }
+  opts := NewSearchPqOptions()
+  opts.IdAlias = "id"
+  matches, err := cl.CallPQDocs("pq", []interface{}{Doc{10, "angry test", 3}, Doc{11, "filter test", 13}}, opts)
+  if err == nil {
+    for _, m := range matches {
+      fmt.Println(m.QueryID, m.DocIDs, m.Docs)
+    }
+  }
+*/
+func (cl *Client) CallPQDocs(index string, docs []interface{}, opts SearchPqOptions) ([]PqMatch, error) {
+	if index == "" {
+		return nil, errors.New("invalid arguments (index must not be empty)")
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("invalid arguments (docs must not be empty)")
+	}
+	stmt, ids, err := pqDocsStatement(index, docs, opts)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := cl.sqlExec(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return parsePqMatches(rs, docs, opts, ids)
+}
@@ -0,0 +1,98 @@
+package manticore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type pqTestDoc struct {
+	ID    uint64 `json:"id"`
+	Title string `json:"title"`
+	Gid   int    `json:"gid"`
+}
+
+func TestPqDocsStatement(t *testing.T) {
+
+	opts := NewSearchPqOptions()
+	opts.Flags = NeedQuery
+	opts.Shift = 100
+	stmt, ids, err := pqDocsStatement("pq", []interface{}{pqTestDoc{10, "it's angry", 3}, `{"title":"raw"}`}, opts)
+	expected := `CALL PQ('pq', ('{"id":10,"title":"it\'s angry","gid":3}', '{"title":"raw"}'), 1 AS docs, ` +
+		`1 AS docs_json, 1 AS query, 0 AS skip_bad_json, 100 AS shift)`
+	if err != nil || stmt != expected || ids != nil {
+		t.Errorf("unexpected statement %s, error %v", stmt, err)
+	}
+
+	opts = NewSearchPqOptions()
+	opts.IdAlias = "id"
+	stmt, ids, err = pqDocsStatement("pq", []interface{}{pqTestDoc{10, "angry", 3}}, opts)
+	expected = `CALL PQ('pq', '{"id":10,"title":"angry","gid":3}', 1 AS docs, 1 AS docs_json, 0 AS query, ` +
+		`0 AS skip_bad_json, 0 AS shift, 'id' AS docs_id)`
+	if err != nil || stmt != expected || !reflect.DeepEqual(ids, map[uint64]int{10: 0}) {
+		t.Errorf("unexpected statement %s, ids %v, error %v", stmt, ids, err)
+	}
+
+	if _, _, err = pqDocsStatement("pq", []interface{}{`{"title":"no id"}`}, opts); err == nil ||
+		err.Error() != "doc 0: no 'id' field" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, _, err = pqDocsStatement("pq", []interface{}{`{bad`}, NewSearchPqOptions()); err == nil {
+		t.Error("error expected for bad json")
+	}
+	opts.Flags |= SkipBadJson
+	if _, _, err = pqDocsStatement("pq", []interface{}{`{bad`}, opts); err != nil {
+		t.Errorf("bad json must be skipped, got %v", err)
+	}
+}
+
+func TestParsePqMatches(t *testing.T) {
+
+	docs := []interface{}{pqTestDoc{10, "angry", 3}, pqTestDoc{11, "test", 13}}
+	rs := Sqlresult{
+		Schema: SqlSchema{{"id", 0, colLonglong, true}, {"documents", 0, colString, false},
+			{"query", 0, colString, false}, {"tags", 0, colString, false}, {"filters", 0, colString, false}},
+		Rows: SqlResultset{{uint64(1), "101,102", "test", "", ""}, {uint64(2), "102", "angry", "a", "gid>3"}},
+	}
+	opts := NewSearchPqOptions()
+	opts.Shift = 100
+	matches, err := parsePqMatches(&rs, docs, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PqMatch{
+		{1, []int{101, 102}, nil, docs, PqQuery{QueryPresent | QueryIsQl | TagsPresent | FiltersPresent, "test", "", ""}},
+		{2, []int{102}, nil, docs[1:], PqQuery{QueryPresent | QueryIsQl | TagsPresent | FiltersPresent, "angry", "a",
+			"gid>3"}},
+	}
+	if !reflect.DeepEqual(matches, expected) {
+		t.Errorf("unexpected matches %v", matches)
+	}
+
+	rs = Sqlresult{
+		Schema: SqlSchema{{"id", 0, colLonglong, true}, {"documents", 0, colString, false}},
+		Rows:   SqlResultset{{uint64(1), "11"}},
+	}
+	matches, err = parsePqMatches(&rs, docs, NewSearchPqOptions(), map[uint64]int{10: 0, 11: 1})
+	if err != nil || len(matches) != 1 || !reflect.DeepEqual(matches[0].DocIDs, []uint64{11}) ||
+		!reflect.DeepEqual(matches[0].Docs, docs[1:]) || matches[0].Ordinals != nil {
+		t.Errorf("unexpected matches %v, error %v", matches, err)
+	}
+}
+
+func TestClient_CallPQDocs(t *testing.T) {
+
+	cl := NewClient()
+	cl.SetServer("", 6712)
+
+	opts := NewSearchPqOptions()
+	opts.Flags = NeedQuery
+	opts.IdAlias = "id"
+	matches, err := cl.CallPQDocs("pq", []interface{}{pqTestDoc{10, "angry test", 3},
+		pqTestDoc{11, "filter test doc2", 13}}, opts)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(matches)
+	}
+}
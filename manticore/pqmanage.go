@@ -0,0 +1,242 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+PqListFilter selects stored queries returned by PQList(). Empty filter returns first `Limit` queries.
+
+IDs
+
+If not empty, only queries with given ids are returned.
+
+Tags
+
+If not empty, only queries having any of given tags are returned.
+
+Offset, Limit
+
+Pagination. Queries are ordered by id. If Limit is 0, daemon's default (20) is used.
+*/
+type PqListFilter struct {
+	IDs           []uint64
+	Tags          []string
+	Offset, Limit int
+}
+
+// pqValues checks stored query and returns sphinxql literals for query, tags and filters columns
+func pqValues(q PqQuery) (string, error) {
+	if q.Flags&QueryPresent != 0 && q.Flags&QueryIsQl == 0 {
+		return "", errors.New("only queries in sphinxql syntax may be stored (set QueryIsQl flag)")
+	}
+	if q.Query == "" {
+		return "", errors.New("invalid arguments (query must not be empty)")
+	}
+	return quoteSQLString(q.Query) + "," + quoteSQLString(q.Tags) + "," + quoteSQLString(q.Filters), nil
+}
+
+func pqInsertStatement(index string, q PqQuery) (string, error) {
+	values, err := pqValues(q)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INSERT INTO %s (query,tags,filters) VALUES (%s)", index, values), nil
+}
+
+func pqReplaceStatement(index string, id uint64, q PqQuery) (string, error) {
+	values, err := pqValues(q)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("REPLACE INTO %s (id,query,tags,filters) VALUES (%d,%s)", index, id, values), nil
+}
+
+func quoteSQLStrings(strs []string) string {
+	items := make([]string, len(strs))
+	for i, str := range strs {
+		items[i] = quoteSQLString(str)
+	}
+	return strings.Join(items, ",")
+}
+
+func pqListStatement(index string, filter PqListFilter) string {
+	var conds []string
+	if len(filter.IDs) > 0 {
+		items := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			items[i] = strconv.FormatUint(id, 10)
+		}
+		conds = append(conds, "id IN ("+strings.Join(items, ",")+")")
+	}
+	if len(filter.Tags) > 0 {
+		conds = append(conds, "tags ANY ("+quoteSQLStrings(filter.Tags)+")")
+	}
+	stmt := "SELECT * FROM " + index
+	if len(conds) > 0 {
+		stmt += " WHERE " + strings.Join(conds, " AND ")
+	}
+	stmt += " ORDER BY id ASC"
+	if filter.Limit > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d,%d", filter.Offset, filter.Limit)
+	} else if filter.Offset > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d,20", filter.Offset)
+	}
+	return stmt
+}
+
+// parsePqList decodes stored queries from SELECT over PQ index into QueryDesc, as CallPQ with NeedQuery returns them.
+func parsePqList(rs *Sqlresult) ([]QueryDesc, error) {
+	id, query, tags, filters := -1, -1, -1, -1
+	for i, col := range rs.Schema {
+		switch col.Name {
+		case "id":
+			id = i
+		case "query":
+			query = i
+		case "tags":
+			tags = i
+		case "filters":
+			filters = i
+		}
+	}
+	if id < 0 || query < 0 {
+		return nil, errors.New("no 'id' or 'query' column in answer")
+	}
+
+	queries := make([]QueryDesc, len(rs.Rows))
+	for j, row := range rs.Rows {
+		desc := &queries[j]
+		desc.QueryID, _ = strconv.ParseUint(fmt.Sprint(row[id]), 10, 64)
+		desc.Query = pqQueryFromRow(row, query, tags, filters)
+	}
+	return queries, nil
+}
+
+// pqQueryFromRow decodes stored query from the row, columns of which are given by numbers (-1 if absent).
+// Query is flagged as sphinxql, unless it is JSON (starts with '{').
+func pqQueryFromRow(row []interface{}, query, tags, filters int) PqQuery {
+	var q PqQuery
+	if query >= 0 {
+		q.Query = fmt.Sprint(row[query])
+		q.Flags |= QueryPresent
+		if !strings.HasPrefix(strings.TrimSpace(q.Query), "{") {
+			q.Flags |= QueryIsQl
+		}
+	}
+	if tags >= 0 {
+		q.Tags = fmt.Sprint(row[tags])
+		q.Flags |= TagsPresent
+	}
+	if filters >= 0 {
+		q.Filters = fmt.Sprint(row[filters])
+		q.Flags |= FiltersPresent
+	}
+	return q
+}
+
+/*
+PQInsert stores query `q` in percolate index, and returns id assigned to it. `q.Query` is full-text query in sphinxql
+syntax, `q.Tags` is comma-separated list of tags, and `q.Filters` is sphinxql filtering expression, like "gid>10".
+Flags of `q` may be left zero; if set, QueryIsQl is required.
+
+Usage example:
+
+  id, err := cl.PQInsert("pq", PqQuery{Query: "@title angry", Tags: "alert,urgent", Filters: "gid>3"})
+*/
+func (cl *Client) PQInsert(index string, q PqQuery) (uint64, error) {
+	if !isSQLIdent(index) {
+		return 0, fmt.Errorf("invalid index name '%s'", index)
+	}
+	stmt, err := pqInsertStatement(index, q)
+	if err != nil {
+		return 0, err
+	}
+	rs, err := cl.sqlExec(stmt)
+	if err != nil {
+		return 0, err
+	}
+	return rs.LastInsertID, nil
+}
+
+// PQReplace stores query `q` in percolate index under given id, replacing existing query with the same id, if any.
+func (cl *Client) PQReplace(index string, id uint64, q PqQuery) error {
+	if !isSQLIdent(index) {
+		return fmt.Errorf("invalid index name '%s'", index)
+	}
+	stmt, err := pqReplaceStatement(index, id, q)
+	if err != nil {
+		return err
+	}
+	_, err = cl.sqlExec(stmt)
+	return err
+}
+
+// PQDelete deletes stored queries with given ids from percolate index. Returns number of deleted queries.
+func (cl *Client) PQDelete(index string, ids ...uint64) (int, error) {
+	if !isSQLIdent(index) {
+		return 0, fmt.Errorf("invalid index name '%s'", index)
+	}
+	if len(ids) == 0 {
+		return 0, errors.New("invalid arguments (ids must not be empty)")
+	}
+	docids := make([]DocID, len(ids))
+	for i, id := range ids {
+		docids[i] = DocID(id)
+	}
+	rs, err := cl.sqlExec(deleteStatement(index, docids))
+	if err != nil {
+		return 0, err
+	}
+	return rs.RowsAffected, nil
+}
+
+// PQDeleteByTags deletes stored queries having any of given tags from percolate index. Returns number of deleted
+// queries.
+func (cl *Client) PQDeleteByTags(index string, tags ...string) (int, error) {
+	if !isSQLIdent(index) {
+		return 0, fmt.Errorf("invalid index name '%s'", index)
+	}
+	if len(tags) == 0 {
+		return 0, errors.New("invalid arguments (tags must not be empty)")
+	}
+	rs, err := cl.sqlExec(fmt.Sprintf("DELETE FROM %s WHERE tags IN (%s)", index, quoteSQLStrings(tags)))
+	if err != nil {
+		return 0, err
+	}
+	return rs.RowsAffected, nil
+}
+
+/*
+PQList returns stored queries of percolate index, selected by `filter`, in the same form as CallPQ() returns
+matched queries with NeedQuery flag. Queries in sphinxql syntax (with QueryIsQl flag) may be stored back with
+PQReplace(); queries stored as JSON (via HTTP) can't, since PQInsert() and PQReplace() accept only sphinxql.
+
+Usage example:
+
+  for filter := (PqListFilter{Tags: []string{"alert"}, Limit: 100}); ; filter.Offset += filter.Limit {
+    queries, err := cl.PQList("pq", filter)
+    if err != nil || len(queries) == 0 {
+      break
+    }
+    for _, q := range queries {
+      fmt.Println(q.QueryID, q.Query.Query, q.Query.Tags)
+    }
+  }
+*/
+func (cl *Client) PQList(index string, filter PqListFilter) ([]QueryDesc, error) {
+	if !isSQLIdent(index) {
+		return nil, fmt.Errorf("invalid index name '%s'", index)
+	}
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, errors.New("invalid arguments (offset and limit must not be negative)")
+	}
+	rs, err := cl.sqlExec(pqListStatement(index, filter))
+	if err != nil {
+		return nil, err
+	}
+	return parsePqList(rs)
+}
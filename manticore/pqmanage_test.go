@@ -0,0 +1,86 @@
+package manticore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPqStatements(t *testing.T) {
+
+	stmt, err := pqInsertStatement("pq", PqQuery{Query: "@title it's", Tags: "a,b", Filters: "gid>3"})
+	if err != nil || stmt != `INSERT INTO pq (query,tags,filters) VALUES ('@title it\'s','a,b','gid>3')` {
+		t.Errorf("unexpected statement %s, error %v", stmt, err)
+	}
+	stmt, err = pqReplaceStatement("pq", 5, PqQuery{QueryPresent | QueryIsQl, "angry", "", ""})
+	if err != nil || stmt != "REPLACE INTO pq (id,query,tags,filters) VALUES (5,'angry','','')" {
+		t.Errorf("unexpected statement %s, error %v", stmt, err)
+	}
+	if _, err = pqInsertStatement("pq", PqQuery{QueryPresent, `{"match":{"title":"angry"}}`, "", ""}); err == nil {
+		t.Error("error expected for json query")
+	}
+	if _, err = pqInsertStatement("pq", PqQuery{}); err == nil {
+		t.Error("error expected for empty query")
+	}
+
+	lists := []struct {
+		filter   PqListFilter
+		expected string
+	}{
+		{PqListFilter{}, "SELECT * FROM pq ORDER BY id ASC"},
+		{PqListFilter{Limit: 10}, "SELECT * FROM pq ORDER BY id ASC LIMIT 0,10"},
+		{PqListFilter{[]uint64{1, 2}, []string{"a", "b"}, 20, 10},
+			"SELECT * FROM pq WHERE id IN (1,2) AND tags ANY ('a','b') ORDER BY id ASC LIMIT 20,10"},
+	}
+	for _, l := range lists {
+		if stmt = pqListStatement("pq", l.filter); stmt != l.expected {
+			t.Errorf("unexpected statement %s", stmt)
+		}
+	}
+}
+
+func TestParsePqList(t *testing.T) {
+
+	rs := Sqlresult{
+		Schema: SqlSchema{{"id", 0, colLonglong, true}, {"query", 0, colString, false},
+			{"tags", 0, colString, false}, {"filters", 0, colString, false}},
+		Rows: SqlResultset{
+			{uint64(1), "angry", "alert", "gid>3"},
+			{uint64(2), `{"match":{"title":"test"}}`, "", ""},
+		},
+	}
+	queries, err := parsePqList(&rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []QueryDesc{
+		{1, nil, PqQuery{QueryPresent | QueryIsQl | TagsPresent | FiltersPresent, "angry", "alert", "gid>3"}},
+		{2, nil, PqQuery{QueryPresent | TagsPresent | FiltersPresent, `{"match":{"title":"test"}}`, "", ""}},
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("unexpected queries %v", queries)
+	}
+
+	if _, err = parsePqList(&Sqlresult{Schema: SqlSchema{{"tags", 0, colString, false}}}); err == nil {
+		t.Error("error expected without query column")
+	}
+}
+
+func TestClient_PQInsert(t *testing.T) {
+
+	cl := NewClient()
+	cl.SetServer("", 6712)
+
+	id, err := cl.PQInsert("pq", PqQuery{Query: "angry", Tags: "alert", Filters: "gid>3"})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	queries, err := cl.PQList("pq", PqListFilter{IDs: []uint64{id}})
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(queries)
+	}
+	_, _ = cl.PQDelete("pq", id)
+}
@@ -0,0 +1,370 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetaIOStats represents i/o statistics of the query from SHOW META (available with profiling enabled).
+type MetaIOStats struct {
+	ReadTime, WriteTime     time.Duration
+	ReadOps, WriteOps       int
+	ReadKBytes, WriteKBytes float32
+}
+
+/*
+QueryMeta is typed content of SHOW META after the query.
+
+`Total`, `TotalFound` and `TotalRelation` - num of matches, total num of matches found, and whether TotalFound is
+exact ("eq") or lower bound ("gte").
+
+`Time` - query time as reported by daemon.
+
+`Keywords` - per-keyword docs and hits statistic.
+
+`CPUTime`, `IOStats` - cpu time and i/o statistics (daemon provides them with profiling enabled, or with --cpustats
+and --iostats options).
+
+`PredictedTime` - predicted time of the query (provided if max_predicted_time was set, or predicted_time_costs
+configured).
+
+`Vars` - all the variables of SHOW META as is, including the ones not parsed into other fields.
+*/
+type QueryMeta struct {
+	Total, TotalFound int
+	TotalRelation     string
+	Time              time.Duration
+	Keywords          []WordStat
+	CPUTime           time.Duration
+	IOStats           MetaIOStats
+	PredictedTime     time.Duration
+	Vars              map[string]string
+}
+
+// ProfileStage is one row of SHOW PROFILE: stage of query processing with it's duration.
+type ProfileStage struct {
+	Status   string
+	Duration time.Duration
+	Switches int
+	Percent  float32
+}
+
+// Stringer interface for ProfileStage type
+func (vl ProfileStage) String() string {
+	return fmt.Sprintf("%s: %v (%d switches, %.2f%%)", vl.Status, vl.Duration, vl.Switches, vl.Percent)
+}
+
+// PlanNode is one node of query plan tree from SHOW PLAN, like AND, PHRASE or KEYWORD.
+// Args are plain (non-node) arguments, as keyword and 'querypos=1' for KEYWORD node.
+type PlanNode struct {
+	Name     string
+	Args     []string
+	Children []*PlanNode
+}
+
+// Stringer interface for PlanNode type. Prints the node in one line, child nodes first, then plain arguments.
+func (node *PlanNode) String() string {
+	items := make([]string, 0, len(node.Args)+len(node.Children))
+	for _, child := range node.Children {
+		items = append(items, child.String())
+	}
+	items = append(items, node.Args...)
+	return fmt.Sprintf("%s(%s)", node.Name, strings.Join(items, ", "))
+}
+
+/*
+QueryProfile holds profiling data of the query, returned by RunQueryWithProfile().
+
+`Stages` - output of SHOW PROFILE.
+
+`Plan` - parsed query tree from SHOW PLAN; `PlanText` - it's raw text. If the text can't be parsed, Plan is nil.
+*/
+type QueryProfile struct {
+	Meta     QueryMeta
+	Stages   []ProfileStage
+	Plan     *PlanNode
+	PlanText string
+}
+
+/*
+RunQueryWithProfile runs the search query with profiling enabled, and returns it's result together with SHOW META,
+SHOW PROFILE and SHOW PLAN output.
+
+Query is converted to SphinxQL by Search.ToSphinxQL(), and executed with all the SHOW statements in one Sphinxql()
+call, since meta is lost between calls. So the query must be expressible in SphinxQL. Result is built from SQL
+resultset: 'id' column becomes DocID, weight becomes Weight, and other columns become attributes with types guessed
+by column types (as AttrInteger, AttrBigint, AttrFloat or AttrString).
+
+If the query itself failed, returned result has StatusError and the message in Error field, and profile is nil.
+
+Usage example:
+
+  res, prof, err := cl.RunQueryWithProfile(NewSearch("hello world", "lj", ""))
+  if err == nil && res.Status != StatusError {
+    fmt.Println(prof.Meta.Time, prof.Stages, prof.Plan)
+  }
+*/
+func (cl *Client) RunQueryWithProfile(q Search) (*QueryResult, *QueryProfile, error) {
+	if q.SelectClause == "" {
+		q.SelectClause = "*, weight()"
+	} else {
+		q.SelectClause += ", weight()"
+	}
+	stmt, err := q.ToSphinxQL()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rss, err := cl.Sphinxql("SET profiling=1; " + stmt + "; SHOW META; SHOW PROFILE; SHOW PLAN")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rss) < 2 {
+		return nil, nil, errors.New("unexpected number of resultsets in profiling answer")
+	}
+	if rss[0].ErrorCode != 0 {
+		return nil, nil, fmt.Errorf("can't enable profiling: %v", rss[0].Msg)
+	}
+	res := sqlQueryResult(&rss[1])
+	if res.Status == StatusError {
+		return res, nil, nil
+	}
+	if len(rss) < 5 {
+		return nil, nil, errors.New("unexpected number of resultsets in profiling answer")
+	}
+
+	prof := &QueryProfile{}
+	prof.Meta = parseQueryMeta(&rss[2])
+	res.Total, res.TotalFound = prof.Meta.Total, prof.Meta.TotalFound
+	res.QueryTime, res.WordStats = prof.Meta.Time, prof.Meta.Keywords
+	if warning, ok := prof.Meta.Vars["warning"]; ok {
+		res.Status, res.Warning = StatusWarning, warning
+	}
+
+	for _, row := range rss[3].Rows {
+		if len(row) < 4 {
+			continue
+		}
+		var stage ProfileStage
+		stage.Status = fmt.Sprint(row[0])
+		stage.Duration = sqlSeconds(fmt.Sprint(row[1]))
+		stage.Switches, _ = strconv.Atoi(fmt.Sprint(row[2]))
+		percent, _ := strconv.ParseFloat(fmt.Sprint(row[3]), 32)
+		stage.Percent = float32(percent)
+		prof.Stages = append(prof.Stages, stage)
+	}
+
+	for _, row := range rss[4].Rows {
+		if len(row) >= 2 && fmt.Sprint(row[0]) == "transformed_tree" {
+			prof.PlanText = fmt.Sprint(row[1])
+		}
+	}
+	prof.Plan, _ = ParsePlan(prof.PlanText)
+	return res, prof, nil
+}
+
+// sqlSeconds parses time in seconds (as "0.001") into duration
+func sqlSeconds(value string) time.Duration {
+	secs, _ := strconv.ParseFloat(value, 64)
+	return time.Duration(secs * float64(time.Second))
+}
+
+// sqlMilliseconds parses time in milliseconds (as "0.350") into duration
+func sqlMilliseconds(value string) time.Duration {
+	msecs, _ := strconv.ParseFloat(value, 64)
+	return time.Duration(msecs * float64(time.Millisecond))
+}
+
+func parseQueryMeta(rs *Sqlresult) QueryMeta {
+	meta := QueryMeta{Vars: make(map[string]string)}
+	for _, row := range rs.Rows {
+		if len(row) < 2 {
+			continue
+		}
+		name, value := fmt.Sprint(row[0]), fmt.Sprint(row[1])
+		meta.Vars[name] = value
+		kbytes, _ := strconv.ParseFloat(value, 32)
+		switch name {
+		case "total":
+			meta.Total, _ = strconv.Atoi(value)
+		case "total_found":
+			meta.TotalFound, _ = strconv.Atoi(value)
+		case "total_relation":
+			meta.TotalRelation = value
+		case "time":
+			meta.Time = sqlSeconds(value)
+		case "cpu_time":
+			meta.CPUTime = sqlMilliseconds(value)
+		case "predicted_time":
+			meta.PredictedTime = sqlMilliseconds(value)
+		case "io_read_time":
+			meta.IOStats.ReadTime = sqlMilliseconds(value)
+		case "io_read_ops":
+			meta.IOStats.ReadOps, _ = strconv.Atoi(value)
+		case "io_read_kbytes":
+			meta.IOStats.ReadKBytes = float32(kbytes)
+		case "io_write_time":
+			meta.IOStats.WriteTime = sqlMilliseconds(value)
+		case "io_write_ops":
+			meta.IOStats.WriteOps, _ = strconv.Atoi(value)
+		case "io_write_kbytes":
+			meta.IOStats.WriteKBytes = float32(kbytes)
+		}
+	}
+
+	// keywords are listed as keyword[0], docs[0], hits[0], keyword[1], ...
+	for i := 0; ; i++ {
+		word, ok := meta.Vars[fmt.Sprintf("keyword[%d]", i)]
+		if !ok {
+			break
+		}
+		docs, _ := strconv.Atoi(meta.Vars[fmt.Sprintf("docs[%d]", i)])
+		hits, _ := strconv.Atoi(meta.Vars[fmt.Sprintf("hits[%d]", i)])
+		meta.Keywords = append(meta.Keywords, WordStat{word, docs, hits})
+	}
+	return meta
+}
+
+// sqlQueryResult converts resultset of SphinxQL SELECT into QueryResult
+func sqlQueryResult(rs *Sqlresult) *QueryResult {
+	res := &QueryResult{Id64: true}
+	if rs.ErrorCode != 0 {
+		res.Status, res.Error = StatusError, string(rs.Msg)
+		return res
+	}
+
+	idcol, weightcol := -1, -1
+	var cols []int
+	for i, field := range rs.Schema {
+		switch field.Name {
+		case "id":
+			idcol = i
+			continue
+		case "weight()", "@weight":
+			weightcol = i
+			continue
+		}
+		var tp EAttrType
+		switch field.Tp {
+		case colDecimal, colLong:
+			tp = AttrInteger
+		case colLonglong:
+			tp = AttrBigint
+		case colFloat:
+			tp = AttrFloat
+		default:
+			tp = AttrString
+		}
+		res.Attrs = append(res.Attrs, ColumnInfo{field.Name, tp})
+		cols = append(cols, i)
+	}
+
+	res.Matches = make([]Match, len(rs.Rows))
+	for j, row := range rs.Rows {
+		match := &res.Matches[j]
+		if idcol >= 0 {
+			id, _ := attrInt(row[idcol])
+			match.DocID = DocID(id)
+		}
+		if weightcol >= 0 {
+			weight, _ := attrInt(row[weightcol])
+			match.Weight = int(weight)
+		}
+		match.Attrs = make([]interface{}, len(cols))
+		for i, col := range cols {
+			switch val := row[col].(type) {
+			case int32:
+				match.Attrs[i] = uint32(val)
+			case int64:
+				match.Attrs[i] = uint64(val)
+			case string:
+				match.Attrs[i] = JsonOrStr{false, val}
+			default:
+				match.Attrs[i] = val
+			}
+		}
+	}
+	res.Total, res.TotalFound = len(res.Matches), len(res.Matches)
+	return res
+}
+
+/*
+ParsePlan parses text of the query tree, as provided by SHOW PLAN, like
+
+  AND(KEYWORD(hello, querypos=1), KEYWORD(world, querypos=2))
+*/
+func ParsePlan(text string) (*PlanNode, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, errors.New("empty plan")
+	}
+	node, rest, err := parsePlanNode(text)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("unexpected '%s' after plan", rest)
+	}
+	return node, nil
+}
+
+// parsePlanNode parses 'NAME(items)' from the beginning of text, and returns the rest of text
+func parsePlanNode(text string) (*PlanNode, string, error) {
+	open := strings.IndexByte(text, '(')
+	if open <= 0 {
+		return nil, "", fmt.Errorf("expected node at '%s'", text)
+	}
+	node := &PlanNode{Name: strings.TrimSpace(text[:open])}
+	text = text[open+1:]
+	for {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if text == "" {
+			return nil, "", fmt.Errorf("unbalanced '(' in node %s", node.Name)
+		}
+		if text[0] == ')' {
+			return node, text[1:], nil
+		}
+
+		// item is child node if it is an identifier followed by '('
+		end := strings.IndexAny(text, "(,)")
+		if end > 0 && text[end] == '(' && isPlanName(strings.TrimSpace(text[:end])) {
+			child, rest, err := parsePlanNode(text)
+			if err != nil {
+				return nil, "", err
+			}
+			node.Children = append(node.Children, child)
+			text = rest
+		} else {
+			if end < 0 {
+				return nil, "", fmt.Errorf("unbalanced '(' in node %s", node.Name)
+			}
+			if arg := strings.TrimSpace(text[:end]); arg != "" {
+				node.Args = append(node.Args, arg)
+			}
+			text = text[end:]
+			if text[0] == '(' {
+				return nil, "", fmt.Errorf("unexpected '(' in node %s", node.Name)
+			}
+		}
+
+		text = strings.TrimLeft(text, " \t\r\n")
+		if strings.HasPrefix(text, ",") {
+			text = text[1:]
+		}
+	}
+}
+
+func isPlanName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
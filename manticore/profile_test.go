@@ -0,0 +1,91 @@
+package manticore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePlan(t *testing.T) {
+
+	text := `AND(
+  AND(KEYWORD(hello, querypos=1)),
+  PHRASE(KEYWORD(big, querypos=2), KEYWORD(world, querypos=3, expanded)))`
+	plan, err := ParsePlan(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Name != "AND" || len(plan.Children) != 2 || plan.Children[1].Name != "PHRASE" {
+		t.Fatalf("unexpected plan %v", plan)
+	}
+	kw := plan.Children[1].Children[1]
+	if kw.Name != "KEYWORD" || !reflect.DeepEqual(kw.Args, []string{"world", "querypos=3", "expanded"}) {
+		t.Errorf("unexpected keyword node %v", kw)
+	}
+	expected := "AND(AND(KEYWORD(hello, querypos=1)), PHRASE(KEYWORD(big, querypos=2), KEYWORD(world, querypos=3, expanded)))"
+	if plan.String() != expected {
+		t.Errorf("plan printed as %s", plan)
+	}
+
+	for _, bad := range []string{"", "AND(KEYWORD(a)", "AND(a)b", "hello"} {
+		if _, err = ParsePlan(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestParseQueryMeta(t *testing.T) {
+
+	rs := Sqlresult{Rows: SqlResultset{
+		{"total", "20"}, {"total_found", "1234"}, {"total_relation", "eq"}, {"time", "0.015"},
+		{"keyword[0]", "hello"}, {"docs[0]", "1000"}, {"hits[0]", "1500"},
+		{"keyword[1]", "world"}, {"docs[1]", "500"}, {"hits[1]", "600"},
+		{"cpu_time", "12.500"}, {"io_read_time", "1.000"}, {"io_read_ops", "3"}, {"io_read_kbytes", "24.5"},
+	}}
+	meta := parseQueryMeta(&rs)
+	if meta.Total != 20 || meta.TotalFound != 1234 || meta.TotalRelation != "eq" || meta.Time != 15*time.Millisecond {
+		t.Errorf("unexpected totals %+v", meta)
+	}
+	if !reflect.DeepEqual(meta.Keywords, []WordStat{{"hello", 1000, 1500}, {"world", 500, 600}}) {
+		t.Errorf("unexpected keywords %v", meta.Keywords)
+	}
+	if meta.CPUTime != 12500*time.Microsecond || meta.IOStats.ReadOps != 3 || meta.IOStats.ReadKBytes != 24.5 {
+		t.Errorf("unexpected stats %+v", meta)
+	}
+}
+
+func TestSqlQueryResult(t *testing.T) {
+
+	rs := Sqlresult{
+		Schema: SqlSchema{{"id", 0, colLonglong, true}, {"gid", 0, colLong, true}, {"title", 0, colString, false},
+			{"weight()", 0, colLong, false}},
+		Rows: SqlResultset{{uint64(10), uint32(1), "hello", int32(2500)}},
+	}
+	res := sqlQueryResult(&rs)
+	if !reflect.DeepEqual(res.Attrs, []ColumnInfo{{"gid", AttrInteger}, {"title", AttrString}}) {
+		t.Errorf("unexpected schema %v", res.Attrs)
+	}
+	if !reflect.DeepEqual(res.Matches, []Match{{10, 2500, []interface{}{uint32(1), JsonOrStr{false, "hello"}}}}) {
+		t.Errorf("unexpected matches %v", res.Matches)
+	}
+
+	res = sqlQueryResult(&Sqlresult{ErrorCode: 1064, Msg: "unknown index"})
+	if res.Status != StatusError || res.Error != "unknown index" {
+		t.Errorf("unexpected error result %v", res)
+	}
+}
+
+func TestClient_RunQueryWithProfile(t *testing.T) {
+
+	cl := NewClient()
+	res, prof, err := cl.RunQueryWithProfile(NewSearch("luther", "lj", ""))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Println(res)
+	if prof != nil {
+		fmt.Println(prof.Meta.Time, prof.Stages, prof.Plan)
+	}
+}
@@ -0,0 +1,444 @@
+package manticore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TableType is type of the table, created by CreateTable().
+type TableType int
+
+const (
+	TableRT TableType = iota // real-time table
+	TablePQ                  // percolate table
+)
+
+// Stringer interface for TableType type
+func (vl TableType) String() string {
+	switch vl {
+	case TableRT:
+		return "rt"
+	case TablePQ:
+		return "pq"
+	default:
+		return fmt.Sprintf("TableType(%d)", int(vl))
+	}
+}
+
+/*
+Column describes one column of the table.
+
+`Type` is AttrNone for full-text field, or type of the attribute. Supported attribute types are AttrInteger,
+AttrBigint, AttrFloat, AttrBool, AttrTimestamp, AttrString, AttrJson, AttrUint32set and AttrInt64set.
+
+`Indexed` and `Stored` are meaningful for full-text fields, which may be indexed (searchable), stored (returned
+with the document), or both. For string attribute `Indexed` means that it is also indexed as full-text field.
+*/
+type Column struct {
+	Name    string
+	Type    EAttrType
+	Indexed bool
+	Stored  bool
+}
+
+// sqlDefinition returns column definition for CREATE TABLE and ALTER TABLE
+func (c Column) sqlDefinition() (string, error) {
+	if !isSQLIdent(c.Name) {
+		return "", fmt.Errorf("invalid column name '%s'", c.Name)
+	}
+	var tp string
+	switch c.Type {
+	case AttrNone:
+		switch {
+		case c.Indexed && c.Stored:
+			tp = "text"
+		case c.Indexed:
+			tp = "text indexed"
+		case c.Stored:
+			tp = "text stored"
+		default:
+			return "", fmt.Errorf("field '%s' must be indexed, stored or both", c.Name)
+		}
+	case AttrInteger:
+		tp = "uint"
+	case AttrBigint:
+		tp = "bigint"
+	case AttrFloat:
+		tp = "float"
+	case AttrBool:
+		tp = "bool"
+	case AttrTimestamp:
+		tp = "timestamp"
+	case AttrString:
+		tp = "string"
+		if c.Indexed {
+			tp = "string attribute indexed"
+		}
+	case AttrJson:
+		tp = "json"
+	case AttrUint32set:
+		tp = "multi"
+	case AttrInt64set:
+		tp = "multi64"
+	default:
+		return "", fmt.Errorf("column '%s' has unsupported type %v", c.Name, c.Type)
+	}
+	return c.Name + " " + tp, nil
+}
+
+/*
+TableSettings are settings of the table. Most used ones have own fields, and the rest may be set in `Other`, as
+name and value, like "ngram_len": "1". Zero values mean default, and are not set explicitly.
+*/
+type TableSettings struct {
+	Morphology   string
+	MinWordLen   int
+	MinInfixLen  int
+	MinPrefixLen int
+	HtmlStrip    bool
+	CharsetTable string
+	Stopwords    string
+	Other        map[string]string
+}
+
+// sqlOptions returns settings as table options for CREATE TABLE
+func (s TableSettings) sqlOptions() []string {
+	var opts []string
+	add := func(name, value string) {
+		opts = append(opts, name+"="+quoteSQLString(value))
+	}
+	if s.Morphology != "" {
+		add("morphology", s.Morphology)
+	}
+	if s.MinWordLen != 0 {
+		add("min_word_len", strconv.Itoa(s.MinWordLen))
+	}
+	if s.MinInfixLen != 0 {
+		add("min_infix_len", strconv.Itoa(s.MinInfixLen))
+	}
+	if s.MinPrefixLen != 0 {
+		add("min_prefix_len", strconv.Itoa(s.MinPrefixLen))
+	}
+	if s.HtmlStrip {
+		add("html_strip", "1")
+	}
+	if s.CharsetTable != "" {
+		add("charset_table", s.CharsetTable)
+	}
+	if s.Stopwords != "" {
+		add("stopwords", s.Stopwords)
+	}
+	names := make([]string, 0, len(s.Other))
+	for name := range s.Other {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, s.Other[name])
+	}
+	return opts
+}
+
+// TableSchema is the full definition of the table, used by CreateTable(). Document id is implicit, and must not be
+// in `Columns`.
+type TableSchema struct {
+	Type     TableType
+	Columns  []Column
+	Settings TableSettings
+}
+
+// createTableStatement builds CREATE TABLE statement
+func createTableStatement(name string, schema TableSchema, ifNotExists bool) (string, error) {
+	if !isSQLIdent(name) {
+		return "", fmt.Errorf("invalid table name '%s'", name)
+	}
+	defs := make([]string, len(schema.Columns))
+	for i, col := range schema.Columns {
+		if strings.ToLower(col.Name) == "id" {
+			return "", errors.New("'id' column is implicit, and must not be in the schema")
+		}
+		def, err := col.sqlDefinition()
+		if err != nil {
+			return "", err
+		}
+		defs[i] = def
+	}
+	if len(defs) == 0 && schema.Type == TableRT {
+		return "", errors.New("rt table must have at least one column")
+	}
+
+	stmt := "CREATE TABLE "
+	if ifNotExists {
+		stmt += "IF NOT EXISTS "
+	}
+	stmt += name
+	if len(defs) > 0 {
+		stmt += "(" + strings.Join(defs, ", ") + ")"
+	}
+	if schema.Type == TablePQ {
+		stmt += " type='pq'"
+	}
+	if opts := schema.Settings.sqlOptions(); len(opts) > 0 {
+		stmt += " " + strings.Join(opts, " ")
+	}
+	return stmt, nil
+}
+
+// alterTableStatements builds ALTER TABLE statements, one per added or dropped column
+func alterTableStatements(name string, add []Column, drop []string) ([]string, error) {
+	if !isSQLIdent(name) {
+		return nil, fmt.Errorf("invalid table name '%s'", name)
+	}
+	var stmts []string
+	for _, col := range add {
+		def, err := col.sqlDefinition()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", name, def))
+	}
+	for _, column := range drop {
+		if !isSQLIdent(column) {
+			return nil, fmt.Errorf("invalid column name '%s'", column)
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", name, column))
+	}
+	return stmts, nil
+}
+
+/*
+CreateTable creates RT or percolate table `name` with given schema. If `ifNotExists` is set, existing table is not
+an error. Works in RT mode of the daemon (with data_dir set).
+
+Usage example:
+
+  err := cl.CreateTable("products", TableSchema{TableRT, []Column{
+    {"title", AttrNone, true, true},
+    {"price", AttrFloat, false, false},
+    {"tags", AttrUint32set, false, false},
+  }, TableSettings{Morphology: "stem_en", MinInfixLen: 3}}, true)
+*/
+func (cl *Client) CreateTable(name string, schema TableSchema, ifNotExists bool) error {
+	stmt, err := createTableStatement(name, schema, ifNotExists)
+	if err != nil {
+		return err
+	}
+	_, err = cl.sqlExec(stmt)
+	return err
+}
+
+// AlterTable adds columns `add` and drops columns `drop` of the table, one ALTER TABLE statement per column.
+// It stops on the first failed statement, so the previous changes remain.
+func (cl *Client) AlterTable(name string, add []Column, drop []string) error {
+	stmts, err := alterTableStatements(name, add, drop)
+	if err != nil {
+		return err
+	}
+	if len(stmts) == 0 {
+		return errors.New("invalid arguments (nothing to alter)")
+	}
+	for _, stmt := range stmts {
+		if _, err = cl.sqlExec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropTable drops the table with all it's data. If `ifExists` is set, absent table is not an error.
+func (cl *Client) DropTable(name string, ifExists bool) error {
+	if !isSQLIdent(name) {
+		return fmt.Errorf("invalid table name '%s'", name)
+	}
+	stmt := "DROP TABLE "
+	if ifExists {
+		stmt += "IF EXISTS "
+	}
+	_, err := cl.sqlExec(stmt + name)
+	return err
+}
+
+// TruncateTable deletes all the documents of RT table. If `reconfigure` is set, settings of the table are reloaded
+// from the config (in plain mode of the daemon).
+func (cl *Client) TruncateTable(name string, reconfigure bool) error {
+	if !isSQLIdent(name) {
+		return fmt.Errorf("invalid table name '%s'", name)
+	}
+	stmt := "TRUNCATE TABLE " + name
+	if reconfigure {
+		stmt += " WITH RECONFIGURE"
+	}
+	_, err := cl.sqlExec(stmt)
+	return err
+}
+
+// Optimize starts merging of disk chunks of RT table. By default optimization runs in background; if `sync` is set,
+// the call waits until it is finished.
+func (cl *Client) Optimize(name string, sync bool) error {
+	if !isSQLIdent(name) {
+		return fmt.Errorf("invalid table name '%s'", name)
+	}
+	stmt := "OPTIMIZE TABLE " + name
+	if sync {
+		stmt += " OPTION sync=1"
+	}
+	_, err := cl.sqlExec(stmt)
+	return err
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// structColumn derives column from the struct field and it's tag options
+func structColumn(field reflect.StructField, opts []string) (Column, error) {
+	col := Column{Name: strings.ToLower(field.Name)}
+	if len(opts) > 0 && opts[0] != "" {
+		col.Name = opts[0]
+	}
+	flags := make(map[string]bool)
+	for _, opt := range opts[1:] {
+		flags[opt] = true
+	}
+
+	tp := field.Type
+	switch {
+	case flags["json"] || tp == rawMessageType:
+		col.Type = AttrJson
+	case tp == timeType || flags["timestamp"]:
+		col.Type = AttrTimestamp
+	default:
+		switch tp.Kind() {
+		case reflect.String:
+			if flags["attribute"] {
+				col.Type = AttrString
+				col.Indexed = flags["indexed"]
+			} else {
+				col.Indexed = flags["indexed"] || !flags["stored"]
+				col.Stored = flags["stored"] || !flags["indexed"]
+			}
+		case reflect.Bool:
+			col.Type = AttrBool
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			col.Type = AttrInteger
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			col.Type = AttrBigint // uint can't keep negative values
+		case reflect.Float32, reflect.Float64:
+			col.Type = AttrFloat
+		case reflect.Slice, reflect.Array:
+			switch tp.Elem().Kind() {
+			case reflect.Uint8:
+				if tp.Kind() == reflect.Slice {
+					col.Type = AttrString // []byte
+				} else {
+					col.Type = AttrUint32set
+				}
+			case reflect.Uint16, reflect.Uint32:
+				col.Type = AttrUint32set
+			case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+				col.Type = AttrInt64set
+			default:
+				col.Type = AttrJson
+			}
+		case reflect.Map, reflect.Struct, reflect.Ptr, reflect.Interface:
+			col.Type = AttrJson
+		default:
+			return col, fmt.Errorf("field %s has unsupported type %v", field.Name, tp)
+		}
+	}
+	if flags["bigint"] && col.Type == AttrInteger {
+		col.Type = AttrBigint
+	}
+	return col, nil
+}
+
+// structColumns collects columns of the struct type, flattening embedded structs
+func structColumns(tp reflect.Type) ([]Column, error) {
+	var columns []Column
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		tag := field.Tag.Get("manticore")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Type != timeType && tag == "" {
+			embedded, err := structColumns(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, embedded...)
+			continue
+		}
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		col, err := structColumn(field, strings.Split(tag, ","))
+		if err != nil {
+			return nil, err
+		}
+		if col.Name == "id" {
+			continue // document id is implicit
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+/*
+SchemaFromStruct derives schema of RT table from the Go struct `v` (struct value or pointer to it), so that
+the table may be described right along with the documents it stores.
+
+Exported fields become columns named as the field in lower case, unless the name is set by `manticore` tag.
+Field named "id" is skipped, since document id is implicit. Embedded structs are flattened. Type of the column
+is derived from Go type of the field: strings are full-text fields (indexed and stored), []byte are string
+attributes, bools are bool, 8-32 bit unsigned integers are uint, other integers are bigint, floats are float,
+time.Time is timestamp, slices of integers are multi (8-32 bit unsigned) or multi64, and maps, structs, other
+slices and json.RawMessage are json.
+
+Tag is `manticore:"name,option,option..."`, or `manticore:"-"` to skip the field. Options are:
+
+  attribute - string is string attribute instead of full-text field
+  indexed   - field is only indexed (not stored); with `attribute` - string attribute is also full-text indexed
+  stored    - field is only stored (not indexed)
+  json      - column is json, whatever Go type is
+  timestamp - integer column is timestamp
+  bigint    - small integer column is bigint
+
+Usage example:
+
+  type Product struct {
+    ID    uint64
+    Title string    `manticore:"title"`
+    SKU   string    `manticore:"sku,attribute"`
+    Price float32   `manticore:"price"`
+    Tags  []uint32  `manticore:"tags"`
+    Added time.Time `manticore:"added"`
+  }
+
+  schema, err := SchemaFromStruct(Product{})
+  if err == nil {
+    schema.Settings.Morphology = "stem_en"
+    err = cl.CreateTable("products", schema, true)
+  }
+*/
+func SchemaFromStruct(v interface{}) (TableSchema, error) {
+	tp := reflect.TypeOf(v)
+	for tp != nil && tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	if tp == nil || tp.Kind() != reflect.Struct {
+		return TableSchema{}, fmt.Errorf("struct expected, got %T", v)
+	}
+	columns, err := structColumns(tp)
+	if err != nil {
+		return TableSchema{}, err
+	}
+	return TableSchema{TableRT, columns, TableSettings{}}, nil
+}
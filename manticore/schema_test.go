@@ -0,0 +1,147 @@
+package manticore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreateTableStatement(t *testing.T) {
+
+	stmt, err := createTableStatement("products", TableSchema{TableRT, []Column{
+		{"title", AttrNone, true, true},
+		{"body", AttrNone, true, false},
+		{"raw", AttrNone, false, true},
+		{"sku", AttrString, true, false},
+		{"gid", AttrInteger, false, false},
+		{"price", AttrFloat, false, false},
+		{"tags", AttrInt64set, false, false},
+		{"meta", AttrJson, false, false},
+	}, TableSettings{Morphology: "stem_en", MinInfixLen: 3, HtmlStrip: true,
+		Other: map[string]string{"ngram_len": "1", "ngram_chars": "cjk"}}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "CREATE TABLE IF NOT EXISTS products(title text, body text indexed, raw text stored, " +
+		"sku string attribute indexed, gid uint, price float, tags multi64, meta json) morphology='stem_en' " +
+		"min_infix_len='3' html_strip='1' ngram_chars='cjk' ngram_len='1'"
+	if stmt != expected {
+		t.Errorf("unexpected statement:\n%s\n%s", stmt, expected)
+	}
+
+	stmt, err = createTableStatement("pq", TableSchema{Type: TablePQ}, false)
+	if err != nil || stmt != "CREATE TABLE pq type='pq'" {
+		t.Errorf("unexpected statement %s, error %v", stmt, err)
+	}
+
+	wrong := []TableSchema{
+		{TableRT, nil, TableSettings{}},
+		{TableRT, []Column{{"id", AttrBigint, false, false}}, TableSettings{}},
+		{TableRT, []Column{{"title", AttrNone, false, false}}, TableSettings{}},
+		{TableRT, []Column{{"poly", AttrPoly2d, false, false}}, TableSettings{}},
+		{TableRT, []Column{{"bad name", AttrInteger, false, false}}, TableSettings{}},
+	}
+	for _, schema := range wrong {
+		if _, err = createTableStatement("products", schema, false); err == nil {
+			t.Errorf("%v: error expected", schema)
+		}
+	}
+	if _, err = createTableStatement("drop table x;", TableSchema{}, false); err == nil {
+		t.Error("error expected for wrong table name")
+	}
+}
+
+func TestAlterTableStatements(t *testing.T) {
+
+	stmts, err := alterTableStatements("products", []Column{{"stock", AttrInteger, false, false}},
+		[]string{"tags"})
+	expected := []string{"ALTER TABLE products ADD COLUMN stock uint", "ALTER TABLE products DROP COLUMN tags"}
+	if err != nil || !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected statements %q, error %v", stmts, err)
+	}
+}
+
+type schemaBase struct {
+	Added time.Time
+}
+
+type schemaDoc struct {
+	schemaBase
+	ID      uint64
+	Title   string
+	Body    string          `manticore:"content,indexed"`
+	SKU     string          `manticore:"sku,attribute"`
+	Gid     int32           `manticore:"group_id"`
+	Stock   uint32          `manticore:"stock"`
+	Big     uint16          `manticore:",bigint"`
+	Hash    []byte          `manticore:"hash"`
+	Price   float64         `manticore:"price"`
+	Active  bool            `manticore:"active"`
+	Tags    []uint32        `manticore:"tags"`
+	Cats    []int64         `manticore:"cats"`
+	Deltas  []int16         `manticore:"deltas"`
+	Meta    json.RawMessage `manticore:"meta"`
+	Extra   map[string]int  `manticore:"extra"`
+	Updated int64           `manticore:"updated,timestamp"`
+	Skip    string          `manticore:"-"`
+	hidden  string
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+
+	schema, err := SchemaFromStruct(&schemaDoc{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Column{
+		{"added", AttrTimestamp, false, false},
+		{"title", AttrNone, true, true},
+		{"content", AttrNone, true, false},
+		{"sku", AttrString, false, false},
+		{"group_id", AttrBigint, false, false},
+		{"stock", AttrInteger, false, false},
+		{"big", AttrBigint, false, false},
+		{"hash", AttrString, false, false},
+		{"price", AttrFloat, false, false},
+		{"active", AttrBool, false, false},
+		{"tags", AttrUint32set, false, false},
+		{"cats", AttrInt64set, false, false},
+		{"deltas", AttrInt64set, false, false},
+		{"meta", AttrJson, false, false},
+		{"extra", AttrJson, false, false},
+		{"updated", AttrTimestamp, false, false},
+	}
+	if schema.Type != TableRT || !reflect.DeepEqual(schema.Columns, expected) {
+		t.Errorf("unexpected schema %v", schema.Columns)
+	}
+
+	if _, err = SchemaFromStruct(42); err == nil {
+		t.Error("error expected for non-struct")
+	}
+	if _, err = SchemaFromStruct(struct{ C chan int }{}); err == nil {
+		t.Error("error expected for unsupported field type")
+	}
+}
+
+func ExampleClient_CreateTable() {
+
+	type Product struct {
+		ID    uint64
+		Title string   `manticore:"title"`
+		Price float32  `manticore:"price"`
+		Tags  []uint32 `manticore:"tags"`
+	}
+
+	cl := NewClient()
+	schema, err := SchemaFromStruct(Product{})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	schema.Settings.Morphology = "stem_en"
+	if err = cl.CreateTable("products", schema, true); err != nil {
+		fmt.Println(err.Error())
+	}
+}
@@ -0,0 +1,213 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+Scroller iterates over all the matches of the search query, batch by batch, without limitation of MaxMatches.
+It is created by Client.Scroll() or Client.ScrollBy() calls.
+
+Instead of Offset, each next batch is requested with a condition which continues the previous one (so-called keyset
+pagination). That is, either IDMin is moved beyond last received document ID, either filter expression
+`attr > last OR (attr = last AND id > lastid)` is added. So the set of matches is stable even for deep pages, and each
+batch costs the same for the daemon.
+
+Matches may be retrieved either one by one:
+
+  sc, err := cl.Scroll(q)
+  ...
+  for sc.Next() {
+    fmt.Println(sc.Match())
+  }
+  if sc.Err() != nil {
+    fmt.Println(sc.Err().Error())
+  }
+
+either batch by batch, with NextBatch() call, which returns empty batch when everything is fetched. Don't mix
+these two ways on the same scroller.
+*/
+type Scroller struct {
+	cl        *Client
+	query     Search
+	attr      string // sorting attribute, empty for scrolling by document ID
+	desc      bool
+	started   bool
+	done      bool
+	lastID    DocID
+	lastValue string
+	attrs     []ColumnInfo
+	batch     []Match
+	pos       int
+	err       error
+}
+
+/*
+Scroll creates Scroller which iterates over all the matches of the query `q` in order of ascending document IDs.
+
+`q` provides query, indexes and filters. It's Limit is used as the size of one batch, and MaxMatches is raised to
+the Limit, if necessary. Sorting mode of `q` is replaced by "@id ASC"; Offset is ignored. Group-by and outer select
+queries can't be scrolled.
+
+No network activity happens at this call; the first batch is requested with the first Next() or NextBatch() call.
+*/
+func (cl *Client) Scroll(q Search) (*Scroller, error) {
+	return cl.newScroller(q, "", false)
+}
+
+/*
+ScrollBy works like Scroll, but iterates matches sorted by numeric `attribute` (int, bigint, float or timestamp),
+with document ID as the secondary key. If `desc` is true, matches are sorted by `attribute` in descending order.
+*/
+func (cl *Client) ScrollBy(q Search, attribute string, desc bool) (*Scroller, error) {
+	if attribute == "" {
+		return nil, errors.New("invalid arguments (attribute must not be empty)")
+	}
+	return cl.newScroller(q, attribute, desc)
+}
+
+func (cl *Client) newScroller(q Search, attribute string, desc bool) (*Scroller, error) {
+	if q.GroupBy != "" {
+		return nil, errors.New("group-by queries can't be scrolled")
+	}
+	if q.hasouter {
+		return nil, errors.New("queries with outer select can't be scrolled")
+	}
+	if q.Limit <= 0 {
+		return nil, errors.New("invalid arguments (query limit must be positive)")
+	}
+
+	q.Offset = 0
+	if q.MaxMatches < q.Limit {
+		q.MaxMatches = q.Limit
+	}
+	if q.IDMax == 0 {
+		q.IDMax = DocidMax
+	}
+	if attribute == "" {
+		q.SetSortMode(SortExtended, "@id ASC")
+	} else if desc {
+		q.SetSortMode(SortExtended, attribute+" DESC, @id ASC")
+	} else {
+		q.SetSortMode(SortExtended, attribute+" ASC, @id ASC")
+	}
+	return &Scroller{cl: cl, query: q, attr: attribute, desc: desc}, nil
+}
+
+// nextQuery provides query for the next batch, continuing after the last received match
+func (sc *Scroller) nextQuery() Search {
+	q := sc.query
+	if !sc.started {
+		return q
+	}
+	if sc.attr == "" {
+		q.IDMin = sc.lastID + 1
+		return q
+	}
+
+	op := ">"
+	if sc.desc {
+		op = "<"
+	}
+	q.filters = make([]searchFilter, len(sc.query.filters), len(sc.query.filters)+1)
+	copy(q.filters, sc.query.filters)
+	q.AddFilterExpression(fmt.Sprintf("%s%s%s OR (%s=%s AND id>%d)",
+		sc.attr, op, sc.lastValue, sc.attr, sc.lastValue, sc.lastID), false)
+	return q
+}
+
+// remember position of the last match in the batch
+func (sc *Scroller) advance(last *Match) error {
+	sc.lastID = last.DocID
+	if sc.attr == "" {
+		if sc.lastID == DocidMax {
+			sc.done = true
+		}
+		return nil
+	}
+
+	for i, col := range sc.attrs {
+		if col.Name != sc.attr {
+			continue
+		}
+		switch val := last.Attrs[i].(type) {
+		case uint32:
+			sc.lastValue = strconv.FormatUint(uint64(val), 10)
+		case uint64:
+			sc.lastValue = strconv.FormatInt(int64(val), 10)
+		case float32:
+			sc.lastValue = strconv.FormatFloat(float64(val), 'g', -1, 32)
+		case time.Time:
+			sc.lastValue = strconv.FormatInt(val.Unix(), 10)
+		default:
+			return fmt.Errorf("attribute '%s' of type %v can't be used for scrolling", sc.attr, col.Type)
+		}
+		return nil
+	}
+	return fmt.Errorf("attribute '%s' is not in the result set", sc.attr)
+}
+
+// NextBatch requests and returns next batch of matches. Returns empty slice when all the matches are fetched.
+// Once error happened, it is returned by all the subsequent calls.
+func (sc *Scroller) NextBatch() ([]Match, error) {
+	if sc.err != nil || sc.done {
+		return nil, sc.err
+	}
+
+	q := sc.nextQuery()
+	res, err := sc.cl.RunQuery(q)
+	if err == nil && (res.Status == StatusError || res.Status == StatusRetry) {
+		err = errors.New(res.Error)
+	}
+	if err != nil {
+		sc.err = err
+		return nil, err
+	}
+
+	sc.started = true
+	sc.attrs = res.Attrs
+	if len(res.Matches) < int(q.Limit) {
+		sc.done = true
+	}
+	if len(res.Matches) == 0 {
+		return nil, nil
+	}
+	if err = sc.advance(&res.Matches[len(res.Matches)-1]); err != nil {
+		sc.err = err
+		return nil, err
+	}
+	return res.Matches, nil
+}
+
+// Next advances to the next match, requesting the next batch if necessary. Returns false when there are no more matches,
+// or error happened (check it then with Err())
+func (sc *Scroller) Next() bool {
+	sc.pos++
+	for sc.pos >= len(sc.batch) {
+		batch, err := sc.NextBatch()
+		if err != nil || len(batch) == 0 {
+			sc.batch = nil
+			return false
+		}
+		sc.batch, sc.pos = batch, 0
+	}
+	return true
+}
+
+// Match returns current match, after Next() returned true.
+func (sc *Scroller) Match() Match {
+	return sc.batch[sc.pos]
+}
+
+// Attrs returns attributes schema of the received matches. It is available after the first batch is received.
+func (sc *Scroller) Attrs() []ColumnInfo {
+	return sc.attrs
+}
+
+// Err returns the error happened during scrolling, if any.
+func (sc *Scroller) Err() error {
+	return sc.err
+}
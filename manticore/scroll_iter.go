@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package manticore
+
+import "iter"
+
+/*
+All returns iterator over all the remaining matches of the Scroller, for use in range-over-func loops:
+
+  for match, err := range sc.All() {
+    if err != nil {
+      fmt.Println(err.Error())
+      break
+    }
+    fmt.Println(match)
+  }
+
+Error, if any, is yielded as the last element with empty Match.
+*/
+func (sc *Scroller) All() iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		for sc.Next() {
+			if !yield(sc.Match(), nil) {
+				return
+			}
+		}
+		if sc.err != nil {
+			yield(Match{}, sc.err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package manticore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClient_Scroll(t *testing.T) {
+	cl := NewClient()
+
+	q := NewSearch("", "lj", "")
+	q.Limit = 100
+	sc, err := cl.Scroll(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for sc.Next() {
+		n++
+	}
+	if sc.Err() != nil {
+		fmt.Println(sc.Err().Error())
+	} else {
+		fmt.Println(n)
+	}
+}
+
+func TestScroller_nextQuery(t *testing.T) {
+	cl := NewClient()
+
+	q := NewSearch("", "lj", "")
+	q.AddFilter("channel_id", []int64{1, 2}, false)
+	sc, _ := cl.Scroll(q)
+
+	first := sc.nextQuery()
+	if first.IDMin != 0 || first.sortby != "@id ASC" {
+		t.Errorf("unexpected first query: idmin %d, sort '%s'", first.IDMin, first.sortby)
+	}
+
+	sc.started = true
+	sc.lastID = 1000
+	next := sc.nextQuery()
+	if next.IDMin != 1001 || next.IDMax != DocidMax || len(next.filters) != 1 {
+		t.Errorf("unexpected next query: idmin %d, idmax %d, filters %v", next.IDMin, next.IDMax, next.filters)
+	}
+
+	sc, _ = cl.ScrollBy(q, "published", true)
+	sc.attrs = []ColumnInfo{{"published", AttrTimestamp}}
+	_ = sc.advance(&Match{1000, 1, []interface{}{uint32(1234567)}})
+	sc.started = true
+	next = sc.nextQuery()
+	if len(next.filters) != 2 || len(sc.query.filters) != 1 {
+		t.Fatalf("expected extra filter in next query only, got %v", next.filters)
+	}
+	expr := next.filters[1].Attribute
+	if expr != "published<1234567 OR (published=1234567 AND id>1000)" {
+		t.Errorf("unexpected keyset filter: %s", expr)
+	}
+	if next.sortby != "published DESC, @id ASC" {
+		t.Errorf("unexpected sort: %s", next.sortby)
+	}
+}
+
+func TestClient_Scroll_groupby(t *testing.T) {
+	cl := NewClient()
+
+	q := NewSearch("", "lj", "")
+	q.SetGroupBy("channel_id", GroupbyAttr)
+	if _, err := cl.Scroll(q); err == nil {
+		t.Errorf("expected error for group-by query")
+	}
+}
@@ -3,6 +3,8 @@ package manticore
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -114,6 +116,7 @@ type Search struct {
 	outeroffset   int32
 	outerlimit    int32
 	hasouter      bool
+	facets        []searchFacet
 	tokenFlibrary string
 	tokenFname    string
 	tokenFopts    string
@@ -144,6 +147,7 @@ func NewSearch(query, index, comment string) Search {
 		"",
 		0, 0,
 		false,
+		nil,
 		"", "", "",
 		index, comment, query,
 	}
@@ -355,6 +359,9 @@ Manticore will compute geosphere distance between the given anchor point and a p
 longitude attributes from each full-text match, and attach this value to the resulting match. The latitude and l
 ongitude values both in SetGeoAnchor and the index attribute data are expected to be in radians. The result will
 be returned in meters, so geodistance value of 1000.0 means 1 km. 1 mile is approximately 1609.344 meters.
+
+If you have anchor point in degrees, use SetGeoAnchorDegrees() instead. To filter and sort by distance
+see WithinRadius() and SortByDistance().
 */
 func (q *Search) SetGeoAnchor(attrlat, attrlong string, lat, long float32) {
 	q.geoLatAttr, q.geoLonAttr = attrlat, attrlong
@@ -511,6 +518,126 @@ func (q *Search) SetTokenFilter(library, name string, opts string) {
 	q.tokenFopts = opts
 }
 
+// SearchFieldError describes one problem found in Search query by Validate()
+type SearchFieldError struct {
+	Field string // name of the field or setter, like "Limit", or "Filters[1]"
+	Msg   string // description of the problem
+}
+
+// Stringer interface for SearchFieldError type
+func (e SearchFieldError) String() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Msg)
+}
+
+// SearchValidationError is returned by Validate() and contains all the problems found in Search query.
+type SearchValidationError []SearchFieldError
+
+func (e SearchValidationError) Error() string {
+	line := "invalid search"
+	for i, problem := range e {
+		if i == 0 {
+			line += ": "
+		} else {
+			line += "; "
+		}
+		line += problem.String()
+	}
+	return line
+}
+
+/*
+Validate performs client-side consistency checks of Search query, which otherwise are rejected only by daemon,
+or silently produce unexpected results. Returns nil if no problems found, or SearchValidationError with
+all the found problems, each with the name of the field (or setter) it belongs to.
+
+Checks are:
+
+Offset and Limit must not be negative, and Offset+Limit must fit into MaxMatches.
+
+Sort modes except SortRelevance require sorting clause, and SortExtended accepts at most 5 sort keys.
+
+RankExpr and RankExport rankers require ranking expression.
+
+Geo anchor requires both latitude and longitude attribute names.
+
+Range filters must have min not greater than max, and all filters except expression must have attribute name.
+
+Outer select requires positive limit.
+
+Client may call it automatically before sending queries, see Client.SetValidation().
+*/
+func (q *Search) Validate() error {
+	var problems SearchValidationError
+	fail := func(field, format string, args ...interface{}) {
+		problems = append(problems, SearchFieldError{field, fmt.Sprintf(format, args...)})
+	}
+
+	if q.Offset < 0 {
+		fail("Offset", "must not be negative (%d)", q.Offset)
+	}
+	if q.Limit < 0 {
+		fail("Limit", "must not be negative (%d)", q.Limit)
+	}
+	if q.MaxMatches <= 0 {
+		fail("MaxMatches", "must be positive (%d)", q.MaxMatches)
+	} else if q.Limit > q.MaxMatches {
+		fail("Limit", "exceeds MaxMatches (%d > %d)", q.Limit, q.MaxMatches)
+	} else if q.Offset > 0 && q.Offset+q.Limit > q.MaxMatches {
+		fail("Offset", "Offset+Limit exceeds MaxMatches (%d > %d)", q.Offset+q.Limit, q.MaxMatches)
+	}
+
+	if q.sort != SortRelevance && q.sortby == "" {
+		fail("SortMode", "sort mode %d requires sorting clause", q.sort)
+	}
+	if q.sort == SortExtended {
+		if nkeys := len(strings.Split(q.sortby, ",")); nkeys > 5 {
+			fail("SortMode", "SortExtended accepts at most 5 sort keys, %d given", nkeys)
+		}
+	}
+
+	if (q.ranker == RankExpr || q.ranker == RankExport) && q.rankexpr == "" {
+		fail("RankingExpression", "ranker %d requires ranking expression", q.ranker)
+	}
+
+	if (q.geoLatAttr == "") != (q.geoLonAttr == "") {
+		fail("GeoAnchor", "both latitude and longitude attribute names must be set")
+	}
+
+	if q.IDMax != 0 && q.IDMin > q.IDMax {
+		fail("IDMin", "greater than IDMax (%d > %d)", q.IDMin, q.IDMax)
+	}
+
+	for i, filter := range q.filters {
+		field := fmt.Sprintf("Filters[%d]", i)
+		if filter.Attribute == "" && filter.FilterType != FilterExpression {
+			fail(field, "empty attribute name")
+		}
+		switch filter.FilterType {
+		case FilterRange:
+			if foo := filter.FilterData.([]int64); foo[0] > foo[1] {
+				fail(field, "range min is greater than max for '%s' (%d > %d)", filter.Attribute, foo[0], foo[1])
+			}
+		case FilterFloatrange:
+			if foo := filter.FilterData.([]float32); foo[0] > foo[1] {
+				fail(field, "range min is greater than max for '%s' (%v > %v)", filter.Attribute, foo[0], foo[1])
+			}
+		case FilterExpression:
+			if filter.Attribute == "" {
+				fail(field, "empty expression")
+			}
+		}
+	}
+
+	if q.hasouter && q.outerlimit <= 0 {
+		fail("OuterSelect", "outer select requires positive limit (%d)", q.outerlimit)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
 // iOStats is internal structure, used only in master-agent communication
 type iOStats struct {
 	ReadTime, ReadBytes, WriteTime, WriteBytes int64
@@ -756,18 +883,9 @@ func (buf *apibuf) buildSearchRequest(q *Search) {
 		buf.putFloat(q.geoLongitude)
 	}
 
-	buf.putLen(len(q.IndexWeights))
-	for idx, iw := range q.IndexWeights {
-		buf.putString(idx)
-		buf.putInt(iw)
-	}
-
+	buf.putWeights(q.IndexWeights)
 	buf.putDuration(q.MaxQueryTime)
-	buf.putLen(len(q.FieldWeights))
-	for idx, iw := range q.FieldWeights {
-		buf.putString(idx)
-		buf.putInt(iw)
-	}
+	buf.putWeights(q.FieldWeights)
 
 	buf.putString(q.Comment)
 	buf.putInt(0) // N of overrides
@@ -789,6 +907,21 @@ func (buf *apibuf) buildSearchRequest(q *Search) {
 	buf.putInt(0) // N of filter tree elems
 }
 
+// putWeights puts map of weights sorted by name, so that the same Search is always encoded to the same bytes
+func (buf *apibuf) putWeights(weights map[string]int32) {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf.putLen(len(names))
+	for _, name := range names {
+		buf.putString(name)
+		buf.putInt(weights[name])
+	}
+}
+
 func (result *QueryResult) makeError(erstr string) error {
 	result.Error = erstr
 	if erstr == "" {
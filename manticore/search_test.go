@@ -192,3 +192,45 @@ func TestSearch_SetOuterSelect(t *testing.T) {
 	}
 }
 
+func TestSearch_Validate(t *testing.T) {
+	q := NewSearch("query", "lj", "")
+	if err := q.Validate(); err != nil {
+		t.Errorf("default search expected to be valid, got %v", err)
+	}
+
+	q.Limit = 2000
+	q.SetRankingMode(RankExpr)
+	q.SetSortMode(SortExtended, "a asc, b asc, c asc, d asc, e asc, f asc")
+	q.SetGeoAnchor("lat", "", 0.5, 0.5)
+	q.AddFilterRange("price", 100, 10, false)
+	q.AddFilterFloatRange("", 1.0, 2.0, false)
+	q.SetOuterSelect("price asc", 0, 0)
+
+	err, ok := q.Validate().(SearchValidationError)
+	if !ok {
+		t.Fatalf("expected SearchValidationError, got %v", q.Validate())
+	}
+	expected := []string{"Limit", "SortMode", "RankingExpression", "GeoAnchor", "Filters[0]", "Filters[1]", "OuterSelect"}
+	if len(err) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), err)
+	}
+	for i, field := range expected {
+		if err[i].Field != field {
+			t.Errorf("problem %d: expected field %s, got %v", i, field, err[i])
+		}
+	}
+}
+
+func TestClient_SetValidation(t *testing.T) {
+	cl := NewClient()
+	cl.SetValidation(true)
+
+	q := NewSearch("query", "lj", "")
+	q.Offset = 990
+
+	_, err := cl.RunQueries([]Search{NewSearch("query", "lj", ""), q})
+	problems, ok := err.(SearchValidationError)
+	if !ok || len(problems) != 1 || problems[0].Field != "[1].Offset" {
+		t.Errorf("expected validation error for second query, got %v", err)
+	}
+}
@@ -0,0 +1,377 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ShardedClient sends the same search to several independent daemons (shards) concurrently, and merges their results
+on the client side, as if they were one index. It is useful when one logical index is split over several hosts
+which are not wired together as a distributed index.
+
+Each shard is served by it's own Client, so they may be configured (timeouts, persistent connections) separately,
+see Shard(). As well as Client, ShardedClient is not safe for concurrent use.
+
+Merged group-by results are approximate, when shards have more groups than they return. Each shard returns only
+it's best Offset+Limit groups, so @count of a group which didn't make it into the top of some shard misses that
+shard's part, and such group may be missed or misplaced in the merged order. TotalFound is exact number of groups
+only if every shard returned all of it's groups; otherwise it is the sum over shards, and so overcounts groups
+present on several shards.
+
+Usage example:
+
+  sh := NewShardedClient(NewClient(), NewClient())
+  sh.Shard(0).SetServer("10.0.0.1", 9312)
+  sh.Shard(1).SetServer("10.0.0.2", 9312)
+  res, err := sh.RunQuery(NewSearch("hello", "products", ""))
+  if err != nil {
+    fmt.Println(err.Error()) // res may be still valid, if only some shards failed
+  }
+*/
+type ShardedClient struct {
+	shards []Client
+}
+
+// NewShardedClient creates sharded client with given clients, one per shard.
+func NewShardedClient(shards ...Client) ShardedClient {
+	return ShardedClient{shards}
+}
+
+// Shard returns client of the shard with number `i`, for configuration.
+func (sh *ShardedClient) Shard(i int) *Client {
+	return &sh.shards[i]
+}
+
+// Shards returns number of shards.
+func (sh *ShardedClient) Shards() int {
+	return len(sh.shards)
+}
+
+// ShardError is an error happened on one of the shards
+type ShardError struct {
+	Shard int
+	Err   error
+}
+
+// ShardErrors is returned by ShardedClient.RunQuery() if one or more shards failed.
+type ShardErrors []ShardError
+
+func (e ShardErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = fmt.Sprintf("shard %d: %v", err.Shard, err.Err)
+	}
+	return strings.Join(lines, "; ")
+}
+
+// sortKey is one item of sorting clause. Name is either attribute name, either "@weight" or "@id"
+type sortKey struct {
+	name string
+	desc bool
+}
+
+// parseSortClause parses SQL-like sorting clause, as "@weight DESC, price ASC"
+func parseSortClause(clause string) []sortKey {
+	var keys []sortKey
+	for _, item := range strings.Split(clause, ",") {
+		words := strings.Fields(item)
+		if len(words) == 0 {
+			continue
+		}
+		key := sortKey{words[0], false}
+		if len(words) > 1 {
+			key.desc = strings.EqualFold(words[1], "desc")
+		}
+		switch strings.ToLower(key.name) {
+		case "@weight", "@rank", "@relevance", "weight()":
+			key.name = "@weight"
+		case "@id", "id":
+			key.name = "@id"
+		case "@group", "groupby()":
+			key.name = "@groupby"
+		case "count(*)":
+			key.name = "@count"
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// mergeSortKeys returns sort keys which reproduce ordering of the query results
+func mergeSortKeys(q *Search) ([]sortKey, error) {
+	var keys []sortKey
+	if q.GroupBy != "" {
+		keys = parseSortClause(q.GroupSort)
+	} else {
+		switch q.sort {
+		case SortRelevance:
+		case SortAttrDesc:
+			keys = []sortKey{{q.sortby, true}}
+		case SortAttrAsc:
+			keys = []sortKey{{q.sortby, false}}
+		case SortExtended:
+			keys = parseSortClause(q.sortby)
+		default:
+			return nil, fmt.Errorf("sort mode %d can't be merged on client side", q.sort)
+		}
+	}
+	for _, key := range keys {
+		if key.name == "@random" {
+			return nil, errors.New("random order can't be merged on client side")
+		}
+		if key.name == "@id" {
+			return keys, nil
+		}
+	}
+	return append(keys, sortKey{"@weight", true}, sortKey{"@id", false}), nil
+}
+
+// compareAttrValues compares two attribute values. Returns -1, 0 or 1.
+func compareAttrValues(a, b interface{}) int {
+	var less, greater bool
+	if va, ok := a.(DocID); ok {
+		vb, _ := b.(DocID)
+		less, greater = va < vb, va > vb
+	} else if va, ok := attrInt(a); ok {
+		vb, _ := attrInt(b)
+		less, greater = va < vb, va > vb
+	} else if va, ok := a.(float32); ok {
+		vb, _ := b.(float32)
+		less, greater = va < vb, va > vb
+	} else {
+		va, vb := attrString(a), attrString(b)
+		less, greater = va < vb, va > vb
+	}
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
+
+func attrString(val interface{}) string {
+	if str, ok := val.(JsonOrStr); ok {
+		return str.Val
+	}
+	return fmt.Sprint(val)
+}
+
+type shardMatch struct {
+	match Match
+	keys  []interface{}
+}
+
+// mergeShardResults merges results of the same query from several shards into one
+func mergeShardResults(q *Search, results []*QueryResult) (*QueryResult, error) {
+	keys, err := mergeSortKeys(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged QueryResult
+	var matches []*shardMatch
+	var truncated bool
+	groups := make(map[string]*shardMatch)
+	words := make(map[string]int)
+	for _, res := range results {
+		if merged.Attrs == nil {
+			merged.Fields, merged.Attrs, merged.Id64 = res.Fields, res.Attrs, res.Id64
+		}
+		if res.Warning != "" {
+			merged.Warning = res.Warning
+		}
+		merged.Total += res.Total
+		merged.TotalFound += res.TotalFound
+		if res.QueryTime > merged.QueryTime {
+			merged.QueryTime = res.QueryTime
+		}
+		for _, ws := range res.WordStats {
+			idx, ok := words[ws.Word]
+			if !ok {
+				words[ws.Word] = len(merged.WordStats)
+				merged.WordStats = append(merged.WordStats, ws)
+				continue
+			}
+			merged.WordStats[idx].Docs += ws.Docs
+			merged.WordStats[idx].Hits += ws.Hits
+		}
+
+		// position of sort keys and group-by magic attributes in the shard's schema
+		idx := make([]int, len(keys))
+		for i, key := range keys {
+			if key.name != "@weight" && key.name != "@id" {
+				if idx[i] = res.AttrIndex(key.name); idx[i] < 0 {
+					return nil, fmt.Errorf("sort attribute '%s' is not in the result set", key.name)
+				}
+			}
+		}
+		groupby, count, distinct := res.AttrIndex("@groupby"), res.AttrIndex("@count"), res.AttrIndex("@distinct")
+		if res.TotalFound > len(res.Matches) {
+			truncated = true
+		}
+
+		for _, match := range res.Matches {
+			if q.GroupBy != "" && groupby >= 0 {
+				gkey := fmt.Sprint(match.Attrs[groupby])
+				if group, ok := groups[gkey]; ok {
+					group.addCounts(match, count)
+					group.addCounts(match, distinct)
+					continue
+				}
+				match.Attrs = append([]interface{}(nil), match.Attrs...)
+			}
+			item := &shardMatch{match, make([]interface{}, len(keys))}
+			for i, key := range keys {
+				switch key.name {
+				case "@weight":
+					item.keys[i] = match.Weight
+				case "@id":
+					item.keys[i] = match.DocID
+				default:
+					item.keys[i] = match.Attrs[idx[i]]
+				}
+			}
+			if q.GroupBy != "" && groupby >= 0 {
+				groups[fmt.Sprint(match.Attrs[groupby])] = item
+			}
+			matches = append(matches, item)
+		}
+	}
+
+	// the same group may come from several shards; if all of them returned all their groups, the count is exact
+	if q.GroupBy != "" && len(groups) > 0 && !truncated {
+		merged.Total, merged.TotalFound = len(groups), len(groups)
+	}
+
+	// counts of groups might be changed, so refresh the sort keys
+	for _, item := range matches {
+		for i, key := range keys {
+			if key.name == "@count" || key.name == "@distinct" {
+				item.keys[i] = item.match.Attrs[merged.AttrIndex(key.name)]
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		for k, key := range keys {
+			if cmp := compareAttrValues(matches[i].keys[k], matches[j].keys[k]); cmp != 0 {
+				return (cmp < 0) != key.desc
+			}
+		}
+		return false
+	})
+
+	from, to := int(q.Offset), int(q.Offset+q.Limit)
+	if from > len(matches) {
+		from = len(matches)
+	}
+	if to > len(matches) {
+		to = len(matches)
+	}
+	merged.Matches = make([]Match, 0, to-from)
+	for _, item := range matches[from:to] {
+		merged.Matches = append(merged.Matches, item.match)
+	}
+	return &merged, nil
+}
+
+// add counter attribute (like @count) of the same group from another shard
+func (sm *shardMatch) addCounts(match Match, idx int) {
+	if idx < 0 {
+		return
+	}
+	if idx >= len(sm.match.Attrs) || idx >= len(match.Attrs) {
+		return
+	}
+	val, ok := attrInt(sm.match.Attrs[idx])
+	add, addok := attrInt(match.Attrs[idx])
+	if !ok || !addok {
+		return
+	}
+	// shards may report the counter with different width, so keep the narrow one only while the sum fits
+	if _, narrow := sm.match.Attrs[idx].(uint32); narrow && val+add <= math.MaxUint32 {
+		sm.match.Attrs[idx] = uint32(val + add)
+	} else {
+		sm.match.Attrs[idx] = uint64(val + add)
+	}
+}
+
+/*
+RunQuery runs query `q` on all the shards concurrently, and merges the results.
+
+Each shard is asked for Offset+Limit best matches (and MaxMatches is raised accordingly); then matches from all
+the shards are sorted together by the sort order of the query, and Offset and Limit are applied to the merged set.
+Supported sort modes are SortRelevance, SortAttrAsc, SortAttrDesc and SortExtended (by attributes, @weight and @id).
+Sort by expression and time segments can't be merged.
+
+For group-by queries the groups with the same @groupby value from different shards are merged, and their
+@count values are summed, then groups are sorted by GroupSort clause. @distinct values are summed too, and so
+are only upper estimation of the real number, if the same values are present on several shards.
+
+Total and TotalFound are summed (for group-by queries see ShardedClient on when they are exact), and WordStats
+are merged by word. QueryTime is the time of the slowest shard.
+
+If some shards failed, merged result of the rest is returned together with ShardErrors error. If all the shards
+failed, result is nil.
+*/
+func (sh *ShardedClient) RunQuery(q Search) (*QueryResult, error) {
+	if len(sh.shards) == 0 {
+		return nil, errors.New("no shards defined")
+	}
+	if _, err := mergeSortKeys(&q); err != nil {
+		return nil, err
+	}
+
+	sq := q
+	sq.Offset, sq.Limit = 0, q.Offset+q.Limit
+	if sq.MaxMatches < sq.Limit {
+		sq.MaxMatches = sq.Limit
+	}
+
+	results := make([]*QueryResult, len(sh.shards))
+	errs := make([]error, len(sh.shards))
+	var wg sync.WaitGroup
+	for i := range sh.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := sh.shards[i].RunQuery(sq)
+			if err == nil && (res.Status == StatusError || res.Status == StatusRetry) {
+				err = errors.New(res.Error)
+			}
+			results[i], errs[i] = res, err
+		}(i)
+	}
+	wg.Wait()
+
+	var failed ShardErrors
+	succeeded := make([]*QueryResult, 0, len(results))
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, ShardError{i, err})
+		} else {
+			succeeded = append(succeeded, results[i])
+		}
+	}
+	if len(succeeded) == 0 {
+		return nil, failed
+	}
+
+	merged, err := mergeShardResults(&q, succeeded)
+	if err != nil {
+		return nil, err
+	}
+	if failed != nil {
+		merged.Status = StatusWarning
+		merged.Warning = failed.Error()
+		return merged, failed
+	}
+	return merged, nil
+}
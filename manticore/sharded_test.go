@@ -0,0 +1,108 @@
+package manticore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShardedClient_RunQuery(t *testing.T) {
+	sh := NewShardedClient(NewClient(), NewClient())
+	sh.Shard(1).SetServer("localhost", 9313)
+
+	res, err := sh.RunQuery(NewSearch("query", "lj", ""))
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	if res != nil {
+		fmt.Println(res)
+	}
+}
+
+func TestMergeShardResults_relevance(t *testing.T) {
+	q := NewSearch("query", "lj", "")
+	q.Offset, q.Limit = 1, 3
+
+	shard1 := QueryResult{Total: 3, TotalFound: 30,
+		Matches:   []Match{{1, 100, nil}, {5, 50, nil}, {7, 10, nil}},
+		WordStats: []WordStat{{"query", 30, 40}}}
+	shard2 := QueryResult{Total: 2, TotalFound: 20,
+		Matches:   []Match{{2, 100, nil}, {4, 70, nil}},
+		WordStats: []WordStat{{"query", 20, 25}}}
+
+	merged, err := mergeShardResults(&q, []*QueryResult{&shard1, &shard2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]DocID, len(merged.Matches))
+	for i, match := range merged.Matches {
+		ids[i] = match.DocID
+	}
+	if fmt.Sprint(ids) != "[2 4 5]" {
+		t.Errorf("unexpected merged matches %v", ids)
+	}
+	if merged.Total != 5 || merged.TotalFound != 50 || merged.WordStats[0].Docs != 50 || merged.WordStats[0].Hits != 65 {
+		t.Errorf("unexpected merged stats %v", merged)
+	}
+}
+
+func TestMergeShardResults_extended(t *testing.T) {
+	q := NewSearch("", "lj", "")
+	q.SetSortMode(SortExtended, "price ASC, @id DESC")
+
+	attrs := []ColumnInfo{{"price", AttrFloat}}
+	shard1 := QueryResult{Attrs: attrs, Matches: []Match{{1, 1, []interface{}{float32(1.5)}}, {3, 1, []interface{}{float32(2)}}}}
+	shard2 := QueryResult{Attrs: attrs, Matches: []Match{{2, 1, []interface{}{float32(1.5)}}, {4, 1, []interface{}{float32(0.5)}}}}
+
+	merged, err := mergeShardResults(&q, []*QueryResult{&shard1, &shard2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]DocID, len(merged.Matches))
+	for i, match := range merged.Matches {
+		ids[i] = match.DocID
+	}
+	if fmt.Sprint(ids) != "[4 2 1 3]" {
+		t.Errorf("unexpected merged matches %v", ids)
+	}
+
+	q.SetSortMode(SortExpr, "price*2")
+	if _, err := mergeShardResults(&q, []*QueryResult{&shard1}); err == nil {
+		t.Errorf("expected error for expression sorting")
+	}
+}
+
+func TestMergeShardResults_groupby(t *testing.T) {
+	q := NewSearch("", "lj", "")
+	q.SetGroupBy("channel_id", GroupbyAttr, "@count desc")
+
+	attrs := []ColumnInfo{{"channel_id", AttrInteger}, {"@groupby", AttrInteger}, {"@count", AttrInteger}}
+	shard1 := QueryResult{Attrs: attrs, TotalFound: 2, Matches: []Match{
+		{1, 1, []interface{}{uint32(10), uint32(10), uint32(5)}},
+		{2, 1, []interface{}{uint32(20), uint32(20), uint32(3)}}}}
+	shard2 := QueryResult{Attrs: attrs, TotalFound: 2, Matches: []Match{
+		{3, 1, []interface{}{uint32(20), uint32(20), uint64(4)}},
+		{4, 1, []interface{}{uint32(30), uint32(30), uint64(1)}}}}
+
+	merged, err := mergeShardResults(&q, []*QueryResult{&shard1, &shard2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Matches) != 3 || merged.Matches[0].Attrs[2] != uint32(7) || merged.Matches[1].Attrs[2] != uint32(5) {
+		t.Errorf("unexpected merged groups %v", merged.Matches)
+	}
+	if shard1.Matches[1].Attrs[2] != uint32(3) {
+		t.Errorf("shard result was modified")
+	}
+	if merged.TotalFound != 3 {
+		t.Errorf("unexpected total found %d", merged.TotalFound)
+	}
+
+	shard2.TotalFound = 5
+	merged, err = mergeShardResults(&q, []*QueryResult{&shard1, &shard2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.TotalFound != 7 {
+		t.Errorf("unexpected total found %d of truncated shard", merged.TotalFound)
+	}
+}
@@ -160,6 +160,7 @@ type Sqlresult struct {
 	RowsAffected int
 	Schema       SqlSchema
 	Rows         SqlResultset
+	LastInsertID uint64 // id of the last inserted document, if any
 }
 
 //Stringer interface for Sqlresult type. provides data like one from mysql cli, as
@@ -272,7 +273,7 @@ func (rs *Sqlresult) parserow(source *apibuf) bool {
 
 func (rs *Sqlresult) parseOK(buf *apibuf) {
 	rs.RowsAffected = buf.getMysqlInt()
-	_ = buf.getMysqlInt() // last_insert_id
+	rs.LastInsertID = buf.getMysqlUint64()
 	_ = buf.getLsbWord()  // status
 	rs.Warnings = buf.getLsbWord()
 	rs.Msg = SqlMsg(buf.getMysqlStrEof())
@@ -286,26 +287,30 @@ func (rs *Sqlresult) parseError(buf *apibuf) {
 }
 
 func (buf *apibuf) getMysqlInt() int {
+	return int(buf.getMysqlUint64())
+}
+
+func (buf *apibuf) getMysqlUint64() uint64 {
 
-	res := int(buf.getByte())
+	res := uint64(buf.getByte())
 	if res < 251 {
 		return res
 	}
 
 	if res == 252 {
-		res = int((*buf)[0]) | int((*buf)[1])<<8
+		res = uint64((*buf)[0]) | uint64((*buf)[1])<<8
 		*buf = (*buf)[2:]
 		return res
 	}
 
 	if res == 253 {
-		res = int((*buf)[0]) | int((*buf)[1])<<8 | int((*buf)[2])<<16
+		res = uint64((*buf)[0]) | uint64((*buf)[1])<<8 | uint64((*buf)[2])<<16
 		*buf = (*buf)[3:]
 		return res
 	}
 
 	if res == 254 {
-		res = int((*buf)[0]) | int((*buf)[1])<<8 | int((*buf)[2])<<16 | int((*buf)[3])<<24
+		res = binary.LittleEndian.Uint64(*buf)
 		*buf = (*buf)[8:]
 	}
 	return res
@@ -28,3 +28,14 @@ func TestClient_Sphinxql_status(t *testing.T) {
 		fmt.Println(foo)
 	}
 }
+
+func TestParseOK(t *testing.T) {
+
+	// affected rows 1, last insert id 0x0102030405060708 (8-byte length-encoded), status, warnings
+	buf := apibuf{1, 254, 8, 7, 6, 5, 4, 3, 2, 1, 2, 0, 0, 0}
+	var rs Sqlresult
+	rs.parseOK(&buf)
+	if rs.RowsAffected != 1 || rs.LastInsertID != 0x0102030405060708 {
+		t.Errorf("unexpected result %d, %x", rs.RowsAffected, rs.LastInsertID)
+	}
+}
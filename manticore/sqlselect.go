@@ -0,0 +1,1135 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// names of rankers in sphinxql OPTION clause, by ERankMode
+var sqlRankers = [RankTotal]string{
+	"proximity_bm25", "bm25", "none", "wordcount", "proximity", "matchany", "fieldmask", "sph04", "expr", "export", "plugin",
+}
+
+// aliases used in select list for the values which have no direct sphinxql equivalent
+const (
+	sqlGeodistAlias = "geodist"
+	sqlGroupAlias   = "groupkey"
+)
+
+// quoteSQLString makes sphinxql string literal
+func quoteSQLString(str string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(str) + "'"
+}
+
+func formatSQLFloat(val float32) string {
+	line := strconv.FormatFloat(float64(val), 'g', -1, 32)
+	if !strings.ContainsAny(line, ".eEn") {
+		line += ".0" // keep literal float, to parse it back as float range
+	}
+	return line
+}
+
+// sqlSortClause converts API sorting clause into sphinxql ORDER BY clause
+func sqlSortClause(clause string) string {
+	keys := parseSortClause(clause)
+	items := make([]string, len(keys))
+	for i, key := range keys {
+		name := key.name
+		switch name {
+		case "@weight":
+			name = "weight()"
+		case "@id":
+			name = "id"
+		case "@groupby":
+			name = "groupby()"
+		case "@count":
+			name = "count(*)"
+		case "@geodist":
+			name = sqlGeodistAlias
+		}
+		if key.desc {
+			items[i] = name + " DESC"
+		} else {
+			items[i] = name + " ASC"
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// apiSortClause converts sphinxql ORDER BY clause into API sorting clause
+func apiSortClause(clause string, grouped bool) string {
+	keys := parseSortClause(clause)
+	items := make([]string, len(keys))
+	for i, key := range keys {
+		name := key.name
+		switch {
+		case name == "@groupby" && grouped:
+			name = "@group"
+		case name == sqlGeodistAlias:
+			name = "@geodist"
+		}
+		if key.desc {
+			items[i] = name + " desc"
+		} else {
+			items[i] = name + " asc"
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+func (q *Search) sqlFilter(filter *searchFilter) (string, error) {
+	attr := filter.Attribute
+	if attr == "@geodist" {
+		attr = sqlGeodistAlias
+	}
+	not := ""
+	if filter.Exclude {
+		not = "NOT "
+	}
+
+	switch filter.FilterType {
+	case FilterValues:
+		values := filter.FilterData.([]int64)
+		if len(values) == 1 {
+			if filter.Exclude {
+				return fmt.Sprintf("%s!=%d", attr, values[0]), nil
+			}
+			return fmt.Sprintf("%s=%d", attr, values[0]), nil
+		}
+		items := make([]string, len(values))
+		for i, val := range values {
+			items[i] = strconv.FormatInt(val, 10)
+		}
+		return fmt.Sprintf("%s %sIN (%s)", attr, not, strings.Join(items, ",")), nil
+	case FilterRange:
+		foo := filter.FilterData.([]int64)
+		min, max := strconv.FormatInt(foo[0], 10), strconv.FormatInt(foo[1], 10)
+		switch {
+		case filter.Exclude:
+			return fmt.Sprintf("(%s<%s OR %s>%s)", attr, min, attr, max), nil
+		case foo[0] == math.MinInt64:
+			return fmt.Sprintf("%s<=%s", attr, max), nil
+		case foo[1] == math.MaxInt64:
+			return fmt.Sprintf("%s>=%s", attr, min), nil
+		}
+		return fmt.Sprintf("%s BETWEEN %s AND %s", attr, min, max), nil
+	case FilterFloatrange:
+		foo := filter.FilterData.([]float32)
+		min, max := formatSQLFloat(foo[0]), formatSQLFloat(foo[1])
+		switch {
+		case filter.Exclude:
+			return fmt.Sprintf("(%s<%s OR %s>%s)", attr, min, attr, max), nil
+		case foo[0] == -math.MaxFloat32:
+			return fmt.Sprintf("%s<=%s", attr, max), nil
+		case foo[1] == math.MaxFloat32:
+			return fmt.Sprintf("%s>=%s", attr, min), nil
+		}
+		return fmt.Sprintf("%s BETWEEN %s AND %s", attr, min, max), nil
+	case FilterString:
+		if filter.Exclude {
+			return fmt.Sprintf("%s!=%s", attr, quoteSQLString(filter.FilterData.(string))), nil
+		}
+		return fmt.Sprintf("%s=%s", attr, quoteSQLString(filter.FilterData.(string))), nil
+	case FilterStringList:
+		values := filter.FilterData.([]string)
+		items := make([]string, len(values))
+		for i, val := range values {
+			items[i] = quoteSQLString(val)
+		}
+		return fmt.Sprintf("%s %sIN (%s)", attr, not, strings.Join(items, ",")), nil
+	case FilterNull:
+		if filter.FilterData.(bool) {
+			return attr + " IS NULL", nil
+		}
+		return attr + " IS NOT NULL", nil
+	case FilterUservar:
+		return fmt.Sprintf("%s %sIN %s", attr, not, filter.FilterData.(string)), nil
+	case FilterExpression:
+		return fmt.Sprintf("%s(%s)", not, attr), nil
+	}
+	return "", fmt.Errorf("unknown filter type %d", filter.FilterType)
+}
+
+func (q *Search) sqlOptions() ([]string, error) {
+	var opts []string
+	switch q.ranker {
+	case RankProximityBm25:
+	case RankExpr, RankExport:
+		opts = append(opts, fmt.Sprintf("ranker=%s(%s)", sqlRankers[q.ranker], quoteSQLString(q.rankexpr)))
+	case RankPlugin:
+		return nil, errors.New("plugin ranker can't be expressed in sphinxql without plugin name")
+	default:
+		if q.ranker >= RankTotal {
+			return nil, fmt.Errorf("unknown ranker %d", q.ranker)
+		}
+		opts = append(opts, "ranker="+sqlRankers[q.ranker])
+	}
+
+	for _, weights := range []struct {
+		name   string
+		values map[string]int32
+	}{{"field_weights", q.FieldWeights}, {"index_weights", q.IndexWeights}} {
+		if len(weights.values) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(weights.values))
+		for name := range weights.values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			names[i] = fmt.Sprintf("%s=%d", name, weights.values[name])
+		}
+		opts = append(opts, fmt.Sprintf("%s=(%s)", weights.name, strings.Join(names, ",")))
+	}
+
+	opts = append(opts, fmt.Sprintf("max_matches=%d", q.MaxMatches))
+	if q.CutOff != 0 {
+		opts = append(opts, fmt.Sprintf("cutoff=%d", q.CutOff))
+	}
+	if q.MaxQueryTime != 0 {
+		opts = append(opts, fmt.Sprintf("max_query_time=%d", q.MaxQueryTime/time.Millisecond))
+	}
+	if q.RetryCount != 0 {
+		opts = append(opts, fmt.Sprintf("retry_count=%d", q.RetryCount))
+	}
+	if q.RetryDelay != 0 {
+		opts = append(opts, fmt.Sprintf("retry_delay=%d", q.RetryDelay/time.Millisecond))
+	}
+	if q.hasSetQueryFlag(QflagMaxPredictedTime) {
+		opts = append(opts, fmt.Sprintf("max_predicted_time=%d", q.predictedTime/time.Millisecond))
+	}
+	if q.hasSetQueryFlag(QflagReverseScan) {
+		opts = append(opts, "reverse_scan=1")
+	}
+	if q.hasSetQueryFlag(QFlagSortKbuffer) {
+		opts = append(opts, "sort_method=kbuffer")
+	}
+	if q.hasSetQueryFlag(QflagSimplify) {
+		opts = append(opts, "boolean_simplify=1")
+	}
+	if q.hasSetQueryFlag(QflagPlainIdf) || !q.hasSetQueryFlag(QflagNormalizedTfIdf) {
+		idf := []string{"normalized", "tfidf_unnormalized"}
+		if q.hasSetQueryFlag(QflagPlainIdf) {
+			idf[0] = "plain"
+		}
+		if q.hasSetQueryFlag(QflagNormalizedTfIdf) {
+			idf[1] = "tfidf_normalized"
+		}
+		opts = append(opts, fmt.Sprintf("idf='%s'", strings.Join(idf, ",")))
+	}
+	if q.hasSetQueryFlag(QflagGlobalIdf) {
+		opts = append(opts, "global_idf=1")
+	}
+	if q.hasSetQueryFlag(QflagLocalDf) {
+		opts = append(opts, "local_df=1")
+	}
+	if q.hasSetQueryFlag(QflagLowPriority) {
+		opts = append(opts, "low_priority=1")
+	}
+	if q.Comment != "" {
+		opts = append(opts, "comment="+quoteSQLString(q.Comment))
+	}
+	return opts, nil
+}
+
+/*
+ToSphinxQL produces SphinxQL SELECT statement, equivalent to the search query. It may be copied into mysql cli,
+or executed via Sphinxql() call.
+
+Geo anchor is expressed as GEODIST() expression with alias 'geodist' in the select list, and time grouping
+functions - as YEARMONTHDAY(), YEARMONTH() or YEAR() with alias 'groupkey'. Count-distinct is added to the select
+list as COUNT(DISTINCT attr). Excluding range filters are expressed as '(attr<min OR attr>max)'.
+
+Returns error for the settings which have no SphinxQL equivalent: sorting by time segments or by expression,
+grouping by week, plugin ranker, and token filter.
+
+Note that SphinxQL always uses extended matching mode, so MatchMode is not taken into account.
+*/
+func (q *Search) ToSphinxQL() (string, error) {
+	switch q.sort {
+	case SortTimeSegments, SortExpr:
+		return "", fmt.Errorf("sort mode %d can't be expressed in sphinxql", q.sort)
+	}
+	if q.tokenFlibrary != "" {
+		return "", errors.New("token filter can't be expressed in sphinxql")
+	}
+
+	selectList := q.SelectClause
+	if selectList == "" {
+		selectList = "*"
+	}
+	grouped := q.GroupBy != ""
+	groupby := q.GroupBy
+	if grouped {
+		fn := ""
+		switch q.Groupfunc {
+		case GroupbyDay:
+			fn = "YEARMONTHDAY"
+		case GroupbyWeek:
+			return "", errors.New("grouping by week can't be expressed in sphinxql")
+		case GroupbyMonth:
+			fn = "YEARMONTH"
+		case GroupbyYear:
+			fn = "YEAR"
+		}
+		if fn != "" {
+			selectList += fmt.Sprintf(", %s(%s) AS %s", fn, q.GroupBy, sqlGroupAlias)
+			groupby = sqlGroupAlias
+		}
+		if q.GroupDistinct != "" {
+			selectList += fmt.Sprintf(", COUNT(DISTINCT %s)", q.GroupDistinct)
+		}
+	}
+	if q.hasGeoAnchor() {
+		selectList += fmt.Sprintf(", GEODIST(%s, %s, %s, %s, {in=rad, out=m}) AS %s", q.geoLatAttr, q.geoLonAttr,
+			formatSQLFloat(q.geoLatitude), formatSQLFloat(q.geoLongitude), sqlGeodistAlias)
+	}
+
+	indexes := strings.Join(splitIndexes(q.Indexes), ", ")
+	stmt := fmt.Sprintf("SELECT %s FROM %s", selectList, indexes)
+
+	var where []string
+	if q.Query != "" {
+		where = append(where, fmt.Sprintf("MATCH(%s)", quoteSQLString(q.Query)))
+	}
+	for i := range q.filters {
+		cond, err := q.sqlFilter(&q.filters[i])
+		if err != nil {
+			return "", err
+		}
+		where = append(where, cond)
+	}
+	if q.IDMax != 0 && q.IDMax != DocidMax {
+		where = append(where, fmt.Sprintf("id BETWEEN %d AND %d", q.IDMin, q.IDMax))
+	} else if q.IDMin != 0 {
+		where = append(where, fmt.Sprintf("id>=%d", q.IDMin))
+	}
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	order := ""
+	switch q.sort {
+	case SortAttrDesc:
+		order = sqlSortClause(q.sortby + " DESC")
+	case SortAttrAsc:
+		order = sqlSortClause(q.sortby + " ASC")
+	case SortExtended:
+		order = sqlSortClause(q.sortby)
+	}
+	if grouped {
+		stmt += " GROUP BY " + groupby
+		if order != "" {
+			stmt += " WITHIN GROUP ORDER BY " + order
+		}
+		order = sqlSortClause(q.GroupSort)
+	}
+	if order != "" {
+		stmt += " ORDER BY " + order
+	}
+	stmt += fmt.Sprintf(" LIMIT %d,%d", q.Offset, q.Limit)
+
+	opts, err := q.sqlOptions()
+	if err != nil {
+		return "", err
+	}
+	stmt += " OPTION " + strings.Join(opts, ", ")
+
+	if q.hasouter {
+		stmt = fmt.Sprintf("SELECT * FROM (%s)", stmt)
+		if q.outerorderby != "" {
+			stmt += " ORDER BY " + q.outerorderby
+		}
+		stmt += fmt.Sprintf(" LIMIT %d,%d", q.outeroffset, q.outerlimit)
+	}
+	return stmt, nil
+}
+
+// tokens of sphinxql statement
+type sqlTokenKind int
+
+const (
+	sqlEOF sqlTokenKind = iota
+	sqlIdent
+	sqlNumber
+	sqlString
+	sqlPunct
+)
+
+type sqlToken struct {
+	kind       sqlTokenKind
+	text       string // unescaped value for strings
+	start, end int    // position in the statement
+}
+
+// is token a keyword (case insensitive)
+func (t sqlToken) is(keyword string) bool {
+	return (t.kind == sqlIdent || t.kind == sqlPunct) && strings.EqualFold(t.text, keyword)
+}
+
+func isSQLIdentChar(c byte) bool {
+	return c == '_' || c == '@' || c == '.' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func tokenizeSQL(stmt string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for pos := 0; pos < len(stmt); {
+		c := stmt[pos]
+		start := pos
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+			continue
+		case c == '\'' || c == '"':
+			var val []byte
+			for pos++; ; pos++ {
+				if pos >= len(stmt) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if stmt[pos] == '\\' && pos+1 < len(stmt) {
+					pos++
+				} else if stmt[pos] == c {
+					break
+				}
+				val = append(val, stmt[pos])
+			}
+			pos++
+			tokens = append(tokens, sqlToken{sqlString, string(val), start, pos})
+			continue
+		case c >= '0' && c <= '9' || (c == '-' || c == '.') && pos+1 < len(stmt) && stmt[pos+1] >= '0' && stmt[pos+1] <= '9':
+			for pos++; pos < len(stmt) && (stmt[pos] >= '0' && stmt[pos] <= '9' || strings.IndexByte(".eE", stmt[pos]) >= 0 ||
+				(stmt[pos] == '-' || stmt[pos] == '+') && (stmt[pos-1] == 'e' || stmt[pos-1] == 'E')); pos++ {
+			}
+			tokens = append(tokens, sqlToken{sqlNumber, stmt[start:pos], start, pos})
+			continue
+		case isSQLIdentChar(c):
+			for pos < len(stmt) && isSQLIdentChar(stmt[pos]) {
+				pos++
+			}
+			tokens = append(tokens, sqlToken{sqlIdent, stmt[start:pos], start, pos})
+			continue
+		}
+		if pos+1 < len(stmt) {
+			switch stmt[pos : pos+2] {
+			case "!=", "<>", "<=", ">=":
+				tokens = append(tokens, sqlToken{sqlPunct, stmt[pos : pos+2], pos, pos + 2})
+				pos += 2
+				continue
+			}
+		}
+		tokens = append(tokens, sqlToken{sqlPunct, stmt[pos : pos+1], pos, pos + 1})
+		pos++
+	}
+	return append(tokens, sqlToken{sqlEOF, "", len(stmt), len(stmt)}), nil
+}
+
+type sqlParser struct {
+	stmt   string
+	tokens []sqlToken
+	pos    int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != sqlEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *sqlParser) fail(format string, args ...interface{}) error {
+	return fmt.Errorf("sphinxql parse error at %d: %s", p.peek().start, fmt.Sprintf(format, args...))
+}
+
+func (p *sqlParser) expect(keyword string) error {
+	if !p.peek().is(keyword) {
+		return p.fail("expected %s", keyword)
+	}
+	p.next()
+	return nil
+}
+
+// clause keywords which terminate the list of items
+func (p *sqlParser) atClauseEnd(depth int) bool {
+	tok := p.peek()
+	if tok.kind == sqlEOF || depth == 0 && (tok.is(")") || tok.is(";")) {
+		return true
+	}
+	if depth > 0 {
+		return false
+	}
+	for _, kw := range []string{"FROM", "WHERE", "GROUP", "WITHIN", "ORDER", "LIMIT", "OPTION"} {
+		if tok.is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// list scans comma-separated list of raw items till the end of clause (or till `stop` keyword on top level)
+func (p *sqlParser) list(stop string) []string {
+	var items []string
+	depth, start := 0, p.peek().start
+	for !p.atClauseEnd(depth) && !(depth == 0 && stop != "" && p.peek().is(stop)) {
+		tok := p.next()
+		switch {
+		case tok.is("(") || tok.is("{"):
+			depth++
+		case tok.is(")") || tok.is("}"):
+			depth--
+		case tok.is(",") && depth == 0:
+			items = append(items, strings.TrimSpace(p.stmt[start:tok.start]))
+			start = p.peek().start
+		}
+	}
+	return append(items, strings.TrimSpace(p.stmt[start:p.peek().start]))
+}
+
+var (
+	sqlCountDistinct = regexp.MustCompile(`(?i)^count\s*\(\s*distinct\s+([\w.@]+)\s*\)$`)
+	sqlGeodist       = regexp.MustCompile(`(?i)^geodist\s*\(\s*([\w.]+)\s*,\s*([\w.]+)\s*,\s*([-\w.+]+)\s*,\s*([-\w.+]+)\s*(,\s*\{[^}]*\})?\s*\)\s+as\s+` + sqlGeodistAlias + `$`)
+	sqlGroupFunc     = regexp.MustCompile(`(?i)^(yearmonthday|yearmonth|year)\s*\(\s*([\w.]+)\s*\)\s+as\s+(\w+)$`)
+)
+
+/*
+ParseSphinxQL parses SphinxQL SELECT statement into Search query. It understands statements produced by
+Search.ToSphinxQL(), and similar hand-written ones:
+
+  SELECT ... FROM ... WHERE MATCH('...') AND filters GROUP BY ... WITHIN GROUP ORDER BY ... ORDER BY ...
+  LIMIT ... OPTION ...
+
+Filters may be comparisons of attributes with numbers or strings (=, !=, <, <=, >, >=), IN and NOT IN lists (or
+user variables), BETWEEN, IS [NOT] NULL, and conditions on 'id'. Any other condition (say, with OR) becomes
+expression filter. Outer select 'SELECT * FROM (SELECT ...) ORDER BY ... LIMIT ...' is also recognized.
+*/
+func ParseSphinxQL(stmt string) (Search, error) {
+	tokens, err := tokenizeSQL(stmt)
+	if err != nil {
+		return Search{}, err
+	}
+	p := sqlParser{stmt: stmt, tokens: tokens}
+	q, err := p.parseSelect()
+	if err != nil {
+		return Search{}, err
+	}
+	if p.peek().is(";") {
+		p.next()
+	}
+	if p.peek().kind != sqlEOF {
+		return Search{}, p.fail("unexpected '%s'", p.peek().text)
+	}
+	return q, nil
+}
+
+func (p *sqlParser) parseSelect() (Search, error) {
+	q := NewSearch("", "", "")
+	if err := p.expect("SELECT"); err != nil {
+		return q, err
+	}
+	selectList := p.list("")
+	if err := p.expect("FROM"); err != nil {
+		return q, err
+	}
+
+	// outer select
+	if p.peek().is("(") {
+		p.next()
+		inner, err := p.parseSelect()
+		if err != nil {
+			return q, err
+		}
+		if err = p.expect(")"); err != nil {
+			return q, err
+		}
+		orderby, offset, limit := "", int32(0), int32(20)
+		if p.peek().is("ORDER") {
+			p.next()
+			if err = p.expect("BY"); err != nil {
+				return q, err
+			}
+			orderby = strings.Join(p.list(""), ", ")
+		}
+		if p.peek().is("LIMIT") {
+			if offset, limit, err = p.parseLimit(); err != nil {
+				return q, err
+			}
+		}
+		inner.SetOuterSelect(orderby, offset, limit)
+		return inner, nil
+	}
+
+	indexes := p.list("")
+	for _, index := range indexes {
+		if index == "" || strings.ContainsAny(index, " \t\n\r") {
+			return q, fmt.Errorf("invalid index name '%s'", index)
+		}
+	}
+	q.Indexes = strings.Join(indexes, ",")
+
+	groupAlias := ""
+	var rest []string
+	for _, item := range selectList {
+		if m := sqlCountDistinct.FindStringSubmatch(item); m != nil {
+			q.GroupDistinct = m[1]
+		} else if m := sqlGeodist.FindStringSubmatch(item); m != nil {
+			lat, err1 := strconv.ParseFloat(m[3], 32)
+			lon, err2 := strconv.ParseFloat(m[4], 32)
+			if err1 != nil || err2 != nil {
+				return q, fmt.Errorf("invalid geodist anchor in '%s'", item)
+			}
+			q.SetGeoAnchor(m[1], m[2], float32(lat), float32(lon))
+		} else if m := sqlGroupFunc.FindStringSubmatch(item); m != nil {
+			switch strings.ToLower(m[1]) {
+			case "yearmonthday":
+				q.Groupfunc = GroupbyDay
+			case "yearmonth":
+				q.Groupfunc = GroupbyMonth
+			case "year":
+				q.Groupfunc = GroupbyYear
+			}
+			q.GroupBy, groupAlias = m[2], m[3]
+		} else {
+			rest = append(rest, item)
+		}
+	}
+	if len(rest) != 1 || rest[0] != "*" {
+		q.SelectClause = strings.Join(rest, ", ")
+	}
+
+	if p.peek().is("WHERE") {
+		p.next()
+		if err := p.parseWhere(&q); err != nil {
+			return q, err
+		}
+	}
+
+	grouped := false
+	if p.peek().is("GROUP") {
+		p.next()
+		if err := p.expect("BY"); err != nil {
+			return q, err
+		}
+		grouped = true
+		attrs := p.list("")
+		if len(attrs) == 1 && attrs[0] == groupAlias && groupAlias != "" {
+			// time function, already set from select list
+		} else if len(attrs) == 1 {
+			q.SetGroupBy(attrs[0], GroupbyAttr)
+		} else {
+			q.SetGroupBy(strings.Join(attrs, ","), GroupbyMultiple)
+		}
+	} else if groupAlias != "" {
+		q.ResetGroupBy()
+	}
+
+	if p.peek().is("WITHIN") {
+		p.next()
+		for _, kw := range []string{"GROUP", "ORDER", "BY"} {
+			if err := p.expect(kw); err != nil {
+				return q, err
+			}
+		}
+		q.setSQLSort(strings.Join(p.list(""), ", "))
+	}
+	if p.peek().is("ORDER") {
+		p.next()
+		if err := p.expect("BY"); err != nil {
+			return q, err
+		}
+		clause := strings.Join(p.list(""), ", ")
+		if grouped {
+			q.GroupSort = apiSortClause(clause, true)
+		} else {
+			q.setSQLSort(clause)
+		}
+	}
+	if p.peek().is("LIMIT") {
+		var err error
+		if q.Offset, q.Limit, err = p.parseLimit(); err != nil {
+			return q, err
+		}
+	}
+	if p.peek().is("OPTION") {
+		p.next()
+		if err := p.parseOptions(&q); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// setSQLSort sets sort mode from sphinxql ORDER BY clause
+func (q *Search) setSQLSort(clause string) {
+	clause = apiSortClause(clause, false)
+	switch clause {
+	case "", "@weight desc", "@weight desc, @id asc":
+		q.SetSortMode(SortRelevance)
+	default:
+		q.SetSortMode(SortExtended, clause)
+	}
+}
+
+func (p *sqlParser) parseInt32() (int32, error) {
+	tok := p.next()
+	val, err := strconv.ParseInt(tok.text, 10, 32)
+	if tok.kind != sqlNumber || err != nil {
+		p.pos--
+		return 0, p.fail("expected integer")
+	}
+	return int32(val), nil
+}
+
+func (p *sqlParser) parseLimit() (offset, limit int32, err error) {
+	p.next() // LIMIT
+	if limit, err = p.parseInt32(); err != nil {
+		return
+	}
+	if p.peek().is(",") {
+		p.next()
+		offset = limit
+		limit, err = p.parseInt32()
+	}
+	return
+}
+
+// literal values of filters
+func (p *sqlParser) parseValues() (ints []int64, floats []float32, strs []string, err error) {
+	for {
+		tok := p.next()
+		switch tok.kind {
+		case sqlString:
+			strs = append(strs, tok.text)
+		case sqlNumber:
+			if strings.ContainsAny(tok.text, ".eE") {
+				val, ferr := strconv.ParseFloat(tok.text, 32)
+				if ferr != nil {
+					p.pos--
+					return nil, nil, nil, p.fail("invalid number")
+				}
+				floats = append(floats, float32(val))
+			} else {
+				val, ierr := strconv.ParseInt(tok.text, 10, 64)
+				if ierr != nil {
+					p.pos--
+					return nil, nil, nil, p.fail("invalid number")
+				}
+				ints = append(ints, val)
+				floats = append(floats, float32(val))
+			}
+		default:
+			p.pos--
+			return nil, nil, nil, p.fail("expected value")
+		}
+		if !p.peek().is(",") {
+			return
+		}
+		p.next()
+	}
+}
+
+// sqlFatalError is returned by parseCondition for conditions which are wrong, rather than just not simple
+type sqlFatalError struct {
+	error
+}
+
+func (p *sqlParser) parseWhere(q *Search) error {
+	for {
+		start := p.pos
+		if err := p.parseCondition(q); err != nil {
+			if fatal, ok := err.(sqlFatalError); ok {
+				return fatal.error
+			}
+			// not a simple condition - take it as expression, till the next top-level AND
+			p.pos = start
+			depth, from := 0, p.peek().start
+			for !p.atClauseEnd(depth) && !(depth == 0 && p.peek().is("AND")) {
+				tok := p.next()
+				switch {
+				case tok.is("("):
+					depth++
+				case tok.is(")"):
+					depth--
+				case tok.is("BETWEEN") && depth == 0:
+					p.next() // min
+					if p.peek().is("AND") {
+						p.next()
+					}
+				}
+			}
+			expr := strings.TrimSpace(p.stmt[from:p.peek().start])
+			if expr == "" {
+				return p.fail("expected condition")
+			}
+			q.addSQLExpression(expr)
+		}
+		if !p.peek().is("AND") {
+			return nil
+		}
+		p.next()
+	}
+}
+
+var sqlExcludeRange = regexp.MustCompile(`^\(\s*([\w.@]+)\s*<\s*([-\d.eE+]+)\s+(?i:or)\s+([\w.@]+)\s*>\s*([-\d.eE+]+)\s*\)$`)
+
+// addSQLExpression adds expression filter, recognizing excluding ranges and negations
+func (q *Search) addSQLExpression(expr string) {
+	if m := sqlExcludeRange.FindStringSubmatch(expr); m != nil && m[1] == m[3] {
+		attr := m[1]
+		if attr == sqlGeodistAlias {
+			attr = "@geodist"
+		}
+		if strings.ContainsAny(m[2]+m[4], ".eE") {
+			min, _ := strconv.ParseFloat(m[2], 32)
+			max, _ := strconv.ParseFloat(m[4], 32)
+			q.AddFilterFloatRange(attr, float32(min), float32(max), true)
+			return
+		}
+		min, err1 := strconv.ParseInt(m[2], 10, 64)
+		max, err2 := strconv.ParseInt(m[4], 10, 64)
+		if err1 == nil && err2 == nil {
+			q.AddFilterRange(attr, min, max, true)
+			return
+		}
+	}
+	exclude := false
+	// NOT applies to the whole expression only if the rest is in parens, as in "NOT (a=1 OR b=2)"
+	if len(expr) > 4 && strings.EqualFold(expr[:4], "NOT ") && enclosedInParens(strings.TrimSpace(expr[4:])) {
+		exclude, expr = true, strings.TrimSpace(expr[4:])
+	}
+	if enclosedInParens(expr) {
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	q.AddFilterExpression(expr, exclude)
+}
+
+// enclosedInParens tells whether the whole expression is in one pair of parens, as "(a=1 OR b=2)", but not
+// "(a=1) OR (b=2)"
+func enclosedInParens(expr string) bool {
+	tokens, err := tokenizeSQL(expr)
+	if err != nil || !tokens[0].is("(") {
+		return false
+	}
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			depth--
+			if depth == 0 {
+				return tokens[i+1].kind == sqlEOF
+			}
+		}
+	}
+	return false
+}
+
+// parseCondition parses one simple condition of WHERE clause. Returns error if condition is not simple.
+func (p *sqlParser) parseCondition(q *Search) error {
+	tok := p.next()
+	if tok.is("MATCH") {
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		str := p.next()
+		if str.kind != sqlString {
+			return p.fail("expected string")
+		}
+		q.Query = str.text
+		return p.expect(")")
+	}
+	if tok.kind != sqlIdent {
+		return p.fail("expected attribute")
+	}
+	attr := tok.text
+	if attr == sqlGeodistAlias && q.hasGeoAnchor() {
+		attr = "@geodist"
+	}
+
+	not := false
+	if p.peek().is("NOT") {
+		p.next()
+		not = true
+	}
+	op := p.next()
+	switch {
+	case op.is("IN"):
+		if p.peek().kind == sqlIdent && strings.HasPrefix(p.peek().text, "@") {
+			q.AddFilterUservar(attr, p.next().text, not)
+			return p.checkConditionEnd()
+		}
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		start := p.pos
+		ints, floats, strs, err := p.parseValues()
+		if err != nil {
+			return err
+		}
+		if len(ints) != len(floats) || (strs != nil && ints != nil) {
+			p.pos = start
+			return sqlFatalError{p.fail("IN list must be either integers or strings")}
+		}
+		if err = p.expect(")"); err != nil {
+			return err
+		}
+		if strs != nil {
+			q.AddFilterStringList(attr, strs, not)
+		} else {
+			q.AddFilter(attr, ints, not)
+		}
+		return p.checkConditionEnd()
+
+	case op.is("BETWEEN") && !not:
+		ints1, floats1, _, err := p.parseValues()
+		if err != nil || len(floats1) != 1 {
+			return p.fail("expected number")
+		}
+		if err = p.expect("AND"); err != nil {
+			return err
+		}
+		ints2, floats2, _, err := p.parseValues()
+		if err != nil || len(floats2) != 1 {
+			return p.fail("expected number")
+		}
+		if err = p.checkConditionEnd(); err != nil {
+			return err
+		}
+		switch {
+		case attr == "id" && ints1 != nil && ints2 != nil:
+			q.IDMin, q.IDMax = DocID(ints1[0]), DocID(ints2[0])
+		case ints1 != nil && ints2 != nil:
+			q.AddFilterRange(attr, ints1[0], ints2[0], false)
+		default:
+			q.AddFilterFloatRange(attr, floats1[0], floats2[0], false)
+		}
+		return nil
+
+	case op.is("IS") && !not:
+		isnull := true
+		if p.peek().is("NOT") {
+			p.next()
+			isnull = false
+		}
+		if err := p.expect("NULL"); err != nil {
+			return err
+		}
+		q.AddFilterNull(attr, isnull)
+		return p.checkConditionEnd()
+
+	case (op.is("=") || op.is("!=") || op.is("<>")) && !not:
+		ints, _, strs, err := p.parseValues()
+		if err != nil || len(ints)+len(strs) != 1 {
+			return p.fail("expected single value")
+		}
+		if err = p.checkConditionEnd(); err != nil {
+			return err
+		}
+		exclude := !op.is("=")
+		if strs != nil {
+			q.AddFilterString(attr, strs[0], exclude)
+		} else if attr == "id" && !exclude {
+			q.IDMin, q.IDMax = DocID(ints[0]), DocID(ints[0])
+		} else {
+			q.AddFilter(attr, ints, exclude)
+		}
+		return nil
+
+	case (op.is("<") || op.is("<=") || op.is(">") || op.is(">=")) && !not:
+		ints, floats, _, err := p.parseValues()
+		if err != nil || len(floats) != 1 {
+			return p.fail("expected number")
+		}
+		if err = p.checkConditionEnd(); err != nil {
+			return err
+		}
+		if ints != nil {
+			val := ints[0]
+			switch op.text {
+			case "<":
+				val--
+			case ">":
+				val++
+			}
+			switch {
+			case attr == "id" && op.text[0] == '<':
+				q.IDMax = DocID(val)
+			case attr == "id":
+				q.IDMin = DocID(val)
+			case op.text[0] == '<':
+				q.AddFilterRange(attr, math.MinInt64, val, false)
+			default:
+				q.AddFilterRange(attr, val, math.MaxInt64, false)
+			}
+			return nil
+		}
+		if op.text[0] == '<' {
+			q.AddFilterFloatRange(attr, -math.MaxFloat32, floats[0], false)
+		} else {
+			q.AddFilterFloatRange(attr, floats[0], math.MaxFloat32, false)
+		}
+		return nil
+	}
+	return p.fail("unsupported condition")
+}
+
+// simple condition must be followed by AND or end of WHERE clause
+func (p *sqlParser) checkConditionEnd() error {
+	if p.peek().is("AND") || p.atClauseEnd(0) {
+		return nil
+	}
+	return p.fail("unexpected '%s'", p.peek().text)
+}
+
+func (p *sqlParser) parseOptions(q *Search) error {
+	for {
+		name := p.next()
+		if name.kind != sqlIdent {
+			return p.fail("expected option name")
+		}
+		if err := p.expect("="); err != nil {
+			return err
+		}
+		switch strings.ToLower(name.text) {
+		case "ranker":
+			ranker := p.next()
+			found := false
+			for i, rname := range sqlRankers {
+				if ranker.is(rname) {
+					q.SetRankingMode(ERankMode(i))
+					found = true
+				}
+			}
+			if !found {
+				return p.fail("unknown ranker '%s'", ranker.text)
+			}
+			if q.ranker == RankExpr || q.ranker == RankExport {
+				if err := p.expect("("); err != nil {
+					return err
+				}
+				expr := p.next()
+				if expr.kind != sqlString {
+					return p.fail("expected ranking expression")
+				}
+				q.rankexpr = expr.text
+				if err := p.expect(")"); err != nil {
+					return err
+				}
+			}
+		case "field_weights", "index_weights":
+			weights, err := p.parseWeights()
+			if err != nil {
+				return err
+			}
+			if strings.EqualFold(name.text, "field_weights") {
+				q.FieldWeights = weights
+			} else {
+				q.IndexWeights = weights
+			}
+		case "comment":
+			val := p.next()
+			if val.kind != sqlString {
+				return p.fail("expected string")
+			}
+			q.Comment = val.text
+		case "sort_method":
+			val := p.next()
+			q.ChangeQueryFlags(QFlagSortKbuffer, val.is("kbuffer"))
+		case "idf":
+			val := p.next()
+			for _, item := range strings.Split(val.text, ",") {
+				switch strings.TrimSpace(item) {
+				case "plain":
+					q.ChangeQueryFlags(QflagPlainIdf, true)
+				case "normalized":
+					q.ChangeQueryFlags(QflagPlainIdf, false)
+				case "tfidf_normalized":
+					q.ChangeQueryFlags(QflagNormalizedTfIdf, true)
+				case "tfidf_unnormalized":
+					q.ChangeQueryFlags(QflagNormalizedTfIdf, false)
+				}
+			}
+		default:
+			val, err := p.parseInt32()
+			if err != nil {
+				return err
+			}
+			if err = q.setSQLIntOption(strings.ToLower(name.text), val); err != nil {
+				p.pos -= 3
+				return p.fail("%v", err)
+			}
+		}
+		if !p.peek().is(",") {
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (q *Search) setSQLIntOption(name string, val int32) error {
+	flags := map[string]Qflags{
+		"reverse_scan":     QflagReverseScan,
+		"boolean_simplify": QflagSimplify,
+		"global_idf":       QflagGlobalIdf,
+		"local_df":         QflagLocalDf,
+		"low_priority":     QflagLowPriority,
+	}
+	if flag, ok := flags[name]; ok {
+		q.ChangeQueryFlags(flag, val != 0)
+		return nil
+	}
+	switch name {
+	case "max_matches":
+		q.MaxMatches = val
+	case "cutoff":
+		q.CutOff = val
+	case "max_query_time":
+		q.MaxQueryTime = time.Duration(val) * time.Millisecond
+	case "retry_count":
+		q.RetryCount = val
+	case "retry_delay":
+		q.RetryDelay = time.Duration(val) * time.Millisecond
+	case "max_predicted_time":
+		q.SetMaxPredictedTime(time.Duration(val) * time.Millisecond)
+	default:
+		return fmt.Errorf("unknown option '%s'", name)
+	}
+	return nil
+}
+
+func (p *sqlParser) parseWeights() (map[string]int32, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	weights := make(map[string]int32)
+	for !p.peek().is(")") {
+		name := p.next()
+		if name.kind != sqlIdent {
+			return nil, p.fail("expected name")
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		val, err := p.parseInt32()
+		if err != nil {
+			return nil, err
+		}
+		weights[name.text] = val
+		if p.peek().is(",") {
+			p.next()
+		}
+	}
+	p.next()
+	return weights, nil
+}
@@ -0,0 +1,175 @@
+package manticore
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearch_ToSphinxQL(t *testing.T) {
+
+	q := NewSearch("hello 'world'", "lj, rt", "")
+	q.SelectClause = "id, title"
+	q.AddFilter("gid", []int64{1}, false)
+	q.AddFilter("tag", []int64{2, 3}, true)
+	q.AddFilterRange("price", 10, 20, false)
+	q.AddFilterRange("year", 2000, 2010, true)
+	q.AddFilterString("lang", "en", false)
+	q.AddFilterNull("j.a", false)
+	q.AddFilterExpression("a>1 OR b<2", false)
+	q.SetSortMode(SortAttrDesc, "price")
+	q.SetRankingMode(RankSph04)
+	q.FieldWeights = map[string]int32{"title": 10, "body": 1}
+	q.Offset, q.Limit = 5, 10
+	q.Comment = "test"
+
+	stmt, err := q.ToSphinxQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `SELECT id, title FROM lj, rt WHERE MATCH('hello \'world\'') AND gid=1 AND tag NOT IN (2,3)` +
+		` AND price BETWEEN 10 AND 20 AND (year<2000 OR year>2010) AND lang='en' AND j.a IS NOT NULL AND (a>1 OR b<2)` +
+		` ORDER BY price DESC LIMIT 5,10 OPTION ranker=sph04, field_weights=(body=1,title=10), max_matches=1000,` +
+		` comment='test'`
+	if stmt != expected {
+		t.Errorf("unexpected statement:\n%s\nexpected:\n%s", stmt, expected)
+	}
+
+	q = NewSearch("", "lj", "")
+	q.SetGroupBy("published", GroupbyDay, "@count desc")
+	q.GroupDistinct = "author"
+	q.SetSortMode(SortExtended, "@weight desc, @id asc")
+	stmt, err = q.ToSphinxQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `SELECT *, YEARMONTHDAY(published) AS groupkey, COUNT(DISTINCT author) FROM lj GROUP BY groupkey` +
+		` WITHIN GROUP ORDER BY weight() DESC, id ASC ORDER BY count(*) DESC LIMIT 0,20 OPTION max_matches=1000`
+	if stmt != expected {
+		t.Errorf("unexpected statement:\n%s\nexpected:\n%s", stmt, expected)
+	}
+
+	q.SetGroupBy("published", GroupbyWeek)
+	if _, err = q.ToSphinxQL(); err == nil {
+		t.Error("expected error for grouping by week")
+	}
+}
+
+func TestParseSphinxQL_roundtrip(t *testing.T) {
+
+	q := NewSearch("@title hello", "lj,rt", "")
+	q.AddFilter("gid", []int64{1}, false)
+	q.AddFilter("tag", []int64{2, 3}, true)
+	q.AddFilterRange("price", 10, 20, false)
+	q.AddFilterRange("year", 2000, 2010, true)
+	q.AddFilterRange("views", 100, math.MaxInt64, false)
+	q.AddFilterFloatRange("rating", 1.5, 4.5, false)
+	q.AddFilterString("lang", "it's", true)
+	q.AddFilterStringList("color", []string{"red", "green"}, false)
+	q.AddFilterNull("j.a", true)
+	q.AddFilterUservar("id", "@ids", false)
+	q.AddFilterExpression("a>1 OR b<2", true)
+	q.SetGeoAnchor("lat", "lon", 0.5, -1.25)
+	q.AddFilterFloatRange("@geodist", 0, 1000, false)
+	q.IDMin, q.IDMax = 10, 1000
+	q.SetSortMode(SortExtended, "@geodist asc, price desc")
+	q.SetRankingMode(RankExpr)
+	q.SetRankingExpression("sum(lcs*user_weight)*1000+bm25")
+	q.IndexWeights = map[string]int32{"lj": 2}
+	q.MaxMatches, q.CutOff, q.RetryCount = 500, 10000, 2
+	q.MaxQueryTime, q.RetryDelay = 3*time.Second, 100*time.Millisecond
+	q.SetMaxPredictedTime(time.Second)
+	q.ChangeQueryFlags(QflagReverseScan|QFlagSortKbuffer|QflagPlainIdf|QflagLowPriority, true)
+	q.Comment = "deep \\ comment"
+	q.SetOuterSelect("price asc", 0, 5)
+
+	stmt, err := q.ToSphinxQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSphinxQL(stmt)
+	if err != nil {
+		t.Fatalf("%s: %v", stmt, err)
+	}
+	if !reflect.DeepEqual(q, parsed) {
+		t.Errorf("%s:\nparsed as\n%#v\nexpected\n%#v", stmt, parsed, q)
+	}
+
+	q = NewSearch("", "*", "")
+	q.SetGroupBy("gid", GroupbyAttr, "@group asc")
+	q.SetSortMode(SortAttrAsc, "price")
+	stmt, err = q.ToSphinxQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = ParseSphinxQL(stmt)
+	if err != nil {
+		t.Fatalf("%s: %v", stmt, err)
+	}
+	q.SetSortMode(SortExtended, "price asc")
+	if !reflect.DeepEqual(q, parsed) {
+		t.Errorf("%s:\nparsed as\n%#v\nexpected\n%#v", stmt, parsed, q)
+	}
+}
+
+func TestParseSphinxQL(t *testing.T) {
+
+	q, err := ParseSphinxQL(`select id, price*2 as p from idx where match('"a b"') and price>10 and rating<=2.5` +
+		` and (x=1 or y=2) order by p desc limit 3 option max_matches=10, reverse_scan=1;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.SelectClause != "id, price*2 as p" || q.Indexes != "idx" || q.Query != `"a b"` {
+		t.Errorf("unexpected select: %s / %s / %s", q.SelectClause, q.Indexes, q.Query)
+	}
+	if len(q.filters) != 3 || q.filters[0].FilterData.([]int64)[0] != 11 || q.filters[2].FilterType != FilterExpression {
+		t.Errorf("unexpected filters: %v", q.filters)
+	}
+	if q.sort != SortExtended || q.sortby != "p desc" || q.Limit != 3 || q.MaxMatches != 10 ||
+		!q.hasSetQueryFlag(QflagReverseScan) {
+		t.Errorf("unexpected settings: %#v", q)
+	}
+
+	for _, cond := range []string{"(a=1) OR (b=2)", "NOT (a=1) OR (b=2)"} {
+		stmt := "select * from idx where " + cond
+		if q, err = ParseSphinxQL(stmt); err != nil {
+			t.Fatal(err)
+		}
+		if len(q.filters) != 1 || q.filters[0].Attribute != cond || q.filters[0].Exclude {
+			t.Errorf("%s: unexpected filters %v", stmt, q.filters)
+		}
+		if sql, err := q.ToSphinxQL(); err != nil || !strings.HasPrefix(sql, "SELECT * FROM idx WHERE ("+cond+") ") {
+			t.Errorf("%s: unexpected %s (%v)", stmt, sql, err)
+		}
+	}
+
+	bad := []string{
+		"",
+		"delete from idx where id=1",
+		"select * from idx where match('unterminated",
+		"select * from idx option unknown_option=1",
+		"select * from idx option ranker=nonexistent",
+		"select * from idx limit x",
+		"select * from idx garbage",
+		"select * from idx where price in (1.5, 2.5)",
+		"select * from idx where tag in (1, 'two')",
+	}
+	for _, stmt := range bad {
+		if _, err = ParseSphinxQL(stmt); err == nil {
+			t.Errorf("%s: expected error", stmt)
+		}
+	}
+}
+
+func ExampleSearch_ToSphinxQL() {
+	q := NewSearch("hello", "lj", "")
+	q.AddFilter("gid", []int64{1, 2}, false)
+	q.SetSortMode(SortAttrDesc, "published")
+	stmt, _ := q.ToSphinxQL()
+	fmt.Println(stmt)
+	// Output:
+	// SELECT * FROM lj WHERE MATCH('hello') AND gid IN (1,2) ORDER BY published DESC LIMIT 0,20 OPTION max_matches=1000
+}
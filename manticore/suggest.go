@@ -0,0 +1,191 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SuggestOptions used to tune CALL SUGGEST and CALL QSUGGEST. All fields are exported and have meaning described below.
+//
+// Limit
+//
+// Returns N top matches.
+//
+// MaxEdits
+//
+// Keeps only dictionary words which Levenshtein distance is less than or equal to N.
+//
+// ResultStats
+//
+// Provides Levenshtein distance and document count of the found words.
+//
+// DeltaLen
+//
+// Keeps only dictionary words whose length difference is less than N.
+//
+// MaxMatches
+//
+// Number of matches to keep.
+//
+// RejectRatio
+//
+// Rejected words are matches that are not better than those already in the match queue. They are put in a rejected
+// queue that gets reset in case one actually can go in the match queue. This parameter defines the size of the
+// rejected queue (as reject*max(max_matches,limit)). If the rejected queue is filled, the engine stops looking
+// for potential matches.
+//
+// NonChar
+//
+// Do not skip dictionary words with non alphabet symbols.
+type SuggestOptions struct {
+	Limit,
+	MaxEdits int32
+	ResultStats bool
+	DeltaLen,
+	MaxMatches,
+	RejectRatio int32
+	NonChar bool
+}
+
+// Create default SuggestOptions with following defaults:
+//
+//  Limit: 5
+//  MaxEdits: 4
+//  ResultStats: true
+//  DeltaLen: 3
+//  MaxMatches: 25
+//  RejectRatio: 4
+//  NonChar: false
+func NewSuggestOptions() *SuggestOptions {
+	res := SuggestOptions{
+		5,
+		4,
+		true,
+		3,
+		25,
+		4,
+		false,
+	}
+	return &res
+}
+
+// Suggestion represents one suggested word returned from Suggest() or QSuggest() call.
+// Distance and Docs are provided only if SuggestOptions.ResultStats was set.
+type Suggestion struct {
+	Suggest  string // suggested word
+	Distance int    // Levenshtein distance to the given word
+	Docs     int    // number of docs containing the word
+}
+
+// Stringer interface for Suggestion type
+func (vl Suggestion) String() string {
+	return fmt.Sprintf("'%s' (Distance:%d, Docs:%d)", vl.Suggest, vl.Distance, vl.Docs)
+}
+
+func boolInt(val bool) int {
+	if val {
+		return 1
+	}
+	return 0
+}
+
+func (cl *Client) callSuggest(proc, word, index string, opts []SuggestOptions) ([]Suggestion, error) {
+	var popts *SuggestOptions
+	if len(opts) > 0 {
+		popts = &opts[0]
+	} else {
+		popts = NewSuggestOptions()
+	}
+
+	if word == "" {
+		return nil, errors.New("invalid arguments (word must not be empty)")
+	}
+
+	if index == "" {
+		return nil, errors.New("invalid arguments (index must not be empty)")
+	}
+
+	stmt := fmt.Sprintf("CALL %s(%s, %s, %d AS limit, %d AS max_edits, %d AS result_stats, %d AS delta_len, "+
+		"%d AS max_matches, %d AS reject, %d AS non_char)", proc, quoteSQLString(word), quoteSQLString(index),
+		popts.Limit, popts.MaxEdits, boolInt(popts.ResultStats), popts.DeltaLen, popts.MaxMatches, popts.RejectRatio,
+		boolInt(popts.NonChar))
+
+	rss, err := cl.Sphinxql(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rss) == 0 {
+		return nil, errors.New("empty answer to " + proc)
+	}
+	return parseSuggestions(&rss[0])
+}
+
+func parseSuggestions(rs *Sqlresult) ([]Suggestion, error) {
+	if rs.ErrorCode != 0 {
+		return nil, fmt.Errorf("ERROR %d %v", rs.ErrorCode, rs.Msg)
+	}
+	suggest, distance, docs := -1, -1, -1
+	for i, col := range rs.Schema {
+		switch col.Name {
+		case "suggest":
+			suggest = i
+		case "distance":
+			distance = i
+		case "docs":
+			docs = i
+		}
+	}
+	if suggest < 0 {
+		return nil, errors.New("no 'suggest' column in answer")
+	}
+
+	suggestions := make([]Suggestion, len(rs.Rows))
+	for j, row := range rs.Rows {
+		suggestions[j].Suggest = fmt.Sprint(row[suggest])
+		if distance >= 0 {
+			suggestions[j].Distance = sqlInt(row[distance])
+		}
+		if docs >= 0 {
+			suggestions[j].Docs = sqlInt(row[docs])
+		}
+	}
+	return suggestions, nil
+}
+
+// sqlInt converts integer value of SphinxQL resultset (which may come as number or as string) into int
+func sqlInt(val interface{}) int {
+	if num, ok := attrInt(val); ok {
+		return int(num)
+	}
+	num, _ := strconv.Atoi(fmt.Sprint(val))
+	return num
+}
+
+/*
+Suggest returns suggestions for the given word, spelled as in index dictionary. It works via CALL SUGGEST, and
+requires infix indexing (min_infix_len) enabled in the index.
+
+`word` is the word to get suggestions for.
+
+`index` is the name of index, which dictionary is used.
+
+`opts` is an optional struct SuggestOptions, it may be created by calling NewSuggestOptions() and then tuned.
+If `opts` is omitted, default will be used.
+
+Usage example:
+
+  suggestions, err := cl.Suggest("crossb", "lj")
+  if err == nil && len(suggestions) > 0 {
+    fmt.Println("did you mean", suggestions[0].Suggest)
+  }
+*/
+func (cl *Client) Suggest(word, index string, opts ...SuggestOptions) ([]Suggestion, error) {
+	return cl.callSuggest("SUGGEST", word, index, opts)
+}
+
+// QSuggest works like Suggest, but accepts whole query, and returns suggestions for it's last word
+// (it works via CALL QSUGGEST).
+func (cl *Client) QSuggest(query, index string, opts ...SuggestOptions) ([]Suggestion, error) {
+	return cl.callSuggest("QSUGGEST", query, index, opts)
+}
@@ -0,0 +1,56 @@
+package manticore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseSuggestions(t *testing.T) {
+
+	rs := Sqlresult{
+		Schema: SqlSchema{{"suggest", 0, colString, false}, {"distance", 0, colString, false},
+			{"docs", 0, colString, false}},
+		Rows: SqlResultset{{"crossbow", "1", "12"}, {"crossbar", "2", "3"}},
+	}
+	suggestions, err := parseSuggestions(&rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Suggestion{{"crossbow", 1, 12}, {"crossbar", 2, 3}}
+	if !reflect.DeepEqual(suggestions, expected) {
+		t.Errorf("unexpected suggestions %v", suggestions)
+	}
+
+	rs = Sqlresult{Schema: SqlSchema{{"suggest", 0, colString, false}}, Rows: SqlResultset{{"crossbow"}}}
+	suggestions, err = parseSuggestions(&rs)
+	if err != nil || !reflect.DeepEqual(suggestions, []Suggestion{{"crossbow", 0, 0}}) {
+		t.Errorf("unexpected suggestions without stats %v (%v)", suggestions, err)
+	}
+
+	rs = Sqlresult{ErrorCode: 1064, Msg: "no such index"}
+	if _, err = parseSuggestions(&rs); err == nil {
+		t.Error("expected error for error resultset")
+	}
+}
+
+func TestClient_Suggest(t *testing.T) {
+
+	cl := NewClient()
+
+	suggestions, err := cl.Suggest("luter", "lj")
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(suggestions)
+	}
+
+	opts := NewSuggestOptions()
+	opts.Limit = 1
+	suggestions, err = cl.QSuggest("martin luter", "lj", *opts)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(suggestions)
+	}
+}
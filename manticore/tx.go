@@ -0,0 +1,206 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+/*
+Tx is a transaction over RT index, started by Client.Begin(). All the statements of the transaction are sent over
+one persistent connection of the client, and changes become visible only after Commit(). As in Manticore itself,
+transaction may change only one RT index, and it can't be nested.
+
+Tx uses the client which started it, so the client must not be used for anything else until the transaction is
+finished with Commit() or Rollback(). Consider WithTx(), which does it automatically.
+
+If the connection is lost in the middle, daemon discards the transaction. Then every next statement fails, instead
+of being silently run over a new connection out of the transaction, and the transaction is finished.
+*/
+type Tx struct {
+	cl       *Client
+	conn     net.Conn // connection of the transaction
+	exec     func(stmt string) (*Sqlresult, error)
+	opened   bool // connection was opened by Begin(), and must be closed when transaction is finished
+	finished bool
+}
+
+/*
+Begin starts transaction. If the client has no persistent connection, it is opened (see Open()), and closed again
+when transaction is finished; otherwise existing connection is used.
+
+Usage example:
+
+  tx, err := cl.Begin()
+  if err != nil {
+    return err
+  }
+  if err = tx.Insert("testrt", 1, map[string]interface{}{"title": "my subject", "gid": 15}); err != nil {
+    _ = tx.Rollback()
+    return err
+  }
+  return tx.Commit()
+*/
+func (cl *Client) Begin() (*Tx, error) {
+	tx := &Tx{cl: cl, exec: cl.sqlExec}
+	if !cl.connected {
+		if _, err := cl.Open(); err != nil {
+			return nil, err
+		}
+		tx.opened = true
+	}
+	tx.conn = cl.conn
+	if _, err := tx.exec("BEGIN"); err != nil {
+		tx.finish()
+		return nil, err
+	}
+	return tx, nil
+}
+
+/*
+WithTx runs `fn` in transaction. Transaction is committed if `fn` returns nil, and rolled back if it returns error
+or panics (panic is then propagated further). Returns error of `fn`, or error of Begin() or Commit().
+
+Usage example:
+
+  err := cl.WithTx(func(tx *Tx) error {
+    if _, err := tx.Delete("testrt", 1, 2); err != nil {
+      return err
+    }
+    return tx.Replace("testrt", 3, map[string]interface{}{"title": "another subject", "gid": 15})
+  })
+*/
+func (cl *Client) WithTx(fn func(tx *Tx) error) error {
+	tx, err := cl.Begin()
+	if err != nil {
+		return err
+	}
+	return tx.do(fn)
+}
+
+// do runs `fn` and then commits or rolls back the transaction, as WithTx() describes
+func (tx *Tx) do(fn func(tx *Tx) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// run executes statement of the transaction, if the connection of the transaction is still alive
+func (tx *Tx) run(stmt string) (*Sqlresult, error) {
+	if tx.finished {
+		return nil, errors.New("transaction is already finished")
+	}
+	if !tx.cl.connected || tx.cl.conn != tx.conn {
+		tx.finish()
+		return nil, errors.New("connection of the transaction is lost, transaction is discarded")
+	}
+	rs, err := tx.exec(stmt)
+	if brokenConnection(err) {
+		if tx.cl.connected && tx.cl.conn == tx.conn {
+			_, _ = tx.cl.Close() // it is dead anyway
+		}
+		tx.finish()
+		return nil, fmt.Errorf("connection of the transaction is lost, transaction is discarded: %v", err)
+	}
+	return rs, err
+}
+
+// finish marks transaction as finished, and closes connection opened by Begin()
+func (tx *Tx) finish() {
+	tx.finished = true
+	if tx.opened && tx.cl.connected {
+		_, _ = tx.cl.Close()
+	}
+}
+
+func (tx *Tx) insert(action BulkAction, index string, id DocID, doc map[string]interface{}) error {
+	if index == "" {
+		return errors.New("invalid arguments (index must not be empty)")
+	}
+	if len(doc) == 0 {
+		return errors.New("invalid arguments (doc must not be empty)")
+	}
+	columns := docColumns(doc)
+	row, err := docRow(id, doc, columns)
+	if err != nil {
+		return err
+	}
+	_, err = tx.run(insertStatement(action, index, columns, []string{row}))
+	return err
+}
+
+// Insert inserts document with given id into the index. Document maps column names to values, with the same types
+// as BulkIndexer.Insert() accepts.
+func (tx *Tx) Insert(index string, id DocID, doc map[string]interface{}) error {
+	return tx.insert(BulkInsert, index, id, doc)
+}
+
+// Replace works like Insert, but replaces the document if it already exists.
+func (tx *Tx) Replace(index string, id DocID, doc map[string]interface{}) error {
+	return tx.insert(BulkReplace, index, id, doc)
+}
+
+// Delete deletes documents with given ids from the index. Returns number of deleted documents.
+func (tx *Tx) Delete(index string, ids ...DocID) (int, error) {
+	if index == "" {
+		return 0, errors.New("invalid arguments (index must not be empty)")
+	}
+	if len(ids) == 0 {
+		return 0, errors.New("invalid arguments (ids must not be empty)")
+	}
+	rs, err := tx.run(deleteStatement(index, ids))
+	if err != nil {
+		return 0, err
+	}
+	return rs.RowsAffected, nil
+}
+
+// Update updates attributes of documents, as UpdateAttributesEx() does, but in the transaction (always via sphinxql
+// UPDATE statements). Returns number of updated documents.
+func (tx *Tx) Update(index string, attrs []UpdateAttr, values map[DocID][]interface{}) (int, error) {
+	if index == "" {
+		return 0, errors.New("invalid arguments (index must not be empty)")
+	}
+	if len(attrs) == 0 {
+		return 0, errors.New("invalid arguments (attrs must not empty)")
+	}
+	ids, checked, err := checkUpdateValues(attrs, values)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, stmt := range buildUpdateStatements(index, attrs, ids, checked, false) {
+		rs, err := tx.run(stmt)
+		if err != nil {
+			return total, err
+		}
+		total += rs.RowsAffected
+	}
+	return total, nil
+}
+
+// Commit commits the transaction. Transaction is finished even if commit failed.
+func (tx *Tx) Commit() error {
+	_, err := tx.run("COMMIT")
+	if !tx.finished {
+		tx.finish()
+	}
+	return err
+}
+
+// Rollback discards all the changes of the transaction.
+func (tx *Tx) Rollback() error {
+	_, err := tx.run("ROLLBACK")
+	if !tx.finished {
+		tx.finish()
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package manticore
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingTx creates transaction which records statements instead of sending them
+func recordingTx(stmts *[]string) *Tx {
+	cl := NewClient()
+	conn, _ := net.Pipe()
+	cl.conn, cl.connected = conn, true
+	return &Tx{cl: &cl, conn: conn, exec: func(stmt string) (*Sqlresult, error) {
+		*stmts = append(*stmts, stmt)
+		return &Sqlresult{RowsAffected: 1}, nil
+	}}
+}
+
+func TestTx_statements(t *testing.T) {
+
+	var stmts []string
+	tx := recordingTx(&stmts)
+	if err := tx.Insert("rt", 1, map[string]interface{}{"title": "hello", "gid": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Replace("rt", 2, map[string]interface{}{"title": "world"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := tx.Delete("rt", 3, 4); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	if n, err := tx.Update("rt", []UpdateAttr{{"price", UpdateAttrFloat}},
+		map[DocID][]interface{}{5: {1.5}, 6: {2}}); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"INSERT INTO rt (id,gid,title) VALUES (1,10,'hello')",
+		"REPLACE INTO rt (id,title) VALUES (2,'world')",
+		"DELETE FROM rt WHERE id IN (3,4)",
+		"UPDATE rt SET price=1.5 WHERE id=5",
+		"UPDATE rt SET price=2.0 WHERE id=6",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+
+	if err := tx.Insert("rt", 7, map[string]interface{}{"title": "late"}); err == nil {
+		t.Error("error expected after commit")
+	}
+	if err := tx.Rollback(); err == nil {
+		t.Error("error expected on rollback after commit")
+	}
+}
+
+func TestTx_do(t *testing.T) {
+
+	var stmts []string
+	failure := errors.New("failure")
+	err := recordingTx(&stmts).do(func(tx *Tx) error {
+		_ = tx.Insert("rt", 1, map[string]interface{}{"gid": 1})
+		return failure
+	})
+	if err != failure || !reflect.DeepEqual(stmts, []string{"INSERT INTO rt (id,gid) VALUES (1,1)", "ROLLBACK"}) {
+		t.Errorf("unexpected error %v or statements %q", err, stmts)
+	}
+
+	stmts = nil
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("panic not propagated: %v", p)
+			}
+		}()
+		_ = recordingTx(&stmts).do(func(tx *Tx) error {
+			panic("boom")
+		})
+	}()
+	if !reflect.DeepEqual(stmts, []string{"ROLLBACK"}) {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+
+	stmts = nil
+	if err = recordingTx(&stmts).do(func(tx *Tx) error { return nil }); err != nil ||
+		!reflect.DeepEqual(stmts, []string{"COMMIT"}) {
+		t.Errorf("unexpected error %v or statements %q", err, stmts)
+	}
+}
+
+func TestTx_lostConnection(t *testing.T) {
+
+	d := newFakeDaemon(t)
+	defer d.Close()
+
+	cl := d.client()
+	tx, err := cl.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Insert("rt", 1, map[string]interface{}{"gid": 1}); err != nil {
+		t.Fatal(err)
+	}
+	_ = (<-d.conns).Close()
+	time.Sleep(10 * time.Millisecond)
+	if err = tx.Insert("rt", 2, map[string]interface{}{"gid": 2}); err == nil {
+		t.Error("error expected after connection is lost")
+	}
+	if err = tx.Commit(); err == nil {
+		t.Error("commit must fail after connection is lost")
+	}
+	if stmts := d.statements(); !reflect.DeepEqual(stmts, []string{"BEGIN", "INSERT INTO rt (id,gid) VALUES (1,1)"}) {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+	if cl.connected {
+		t.Error("broken connection is left open")
+	}
+
+	// client reconnected behind the transaction
+	var stmts []string
+	tx = recordingTx(&stmts)
+	tx.cl.conn, _ = net.Pipe()
+	if _, err := tx.Delete("rt", 1); err == nil || !tx.finished {
+		t.Errorf("transaction must fail over new connection, got %v", err)
+	}
+	if len(stmts) != 0 {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+}
+
+func ExampleClient_WithTx() {
+
+	cl := NewClient()
+	err := cl.WithTx(func(tx *Tx) error {
+		if err := tx.Replace("testrt", 1, map[string]interface{}{"title": "my subject", "gid": 15}); err != nil {
+			return err
+		}
+		_, err := tx.Delete("testrt", 5)
+		return err
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
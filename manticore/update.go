@@ -1,4 +1,16 @@
 package manticore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 /*
 EUpdateType is values for `vtype` of UpdateAttributes() call, which determines meaning of `values` param of this function.
 
@@ -28,43 +40,470 @@ const (
 	UpdateJson
 )
 
-func buildUpdateRequest(index string, attrs []string, values map[DocID][]interface{},
-	vtype EUpdateType, ignorenonexistent bool) func(*apibuf) {
+/*
+EUpdateAttrType is type of single attribute in UpdateAttributesEx() call, which determines which values are accepted
+for the attribute.
+
+UpdateAttrInt
+
+32-bit integer attribute. Value may be any Go integer in range of int32 or uint32.
+
+UpdateAttrBigint
+
+64-bit signed integer attribute. Value may be any Go integer which fits into int64.
+
+UpdateAttrFloat
+
+Float attribute. Value may be float32, float64 or any Go integer.
+
+UpdateAttrTimestamp
+
+Timestamp attribute. Value may be time.Time or integer number of seconds since epoch (must fit into uint32).
+
+UpdateAttrMva32
+
+MVA attribute of 32-bit values. Value is slice of integers ([]uint32, []uint64, []int, []int32 or []int64), each of
+them must fit into uint32.
+
+UpdateAttrMva64
+
+MVA attribute of 64-bit values. Value is slice of integers, same as for UpdateAttrMva32, each must fit into int64.
+
+UpdateAttrString
+
+String attribute. Value must be string.
+
+UpdateAttrJson
+
+Whole JSON attribute. Value may be string or []byte (json.RawMessage) with valid JSON, or any other value,
+which is then marshaled with encoding/json.
+
+UpdateAttrJsonPath
+
+Numeric value inside JSON attribute, as `Name` like "meta.price" or "meta.counts[0]". Value may be any Go integer
+or float.
+*/
+type EUpdateAttrType uint32
+
+const (
+	UpdateAttrInt EUpdateAttrType = iota
+	UpdateAttrBigint
+	UpdateAttrFloat
+	UpdateAttrTimestamp
+	UpdateAttrMva32
+	UpdateAttrMva64
+	UpdateAttrString
+	UpdateAttrJson
+	UpdateAttrJsonPath
+)
+
+// Stringer interface for EUpdateAttrType type
+func (vl EUpdateAttrType) String() string {
+	switch vl {
+	case UpdateAttrInt:
+		return "int"
+	case UpdateAttrBigint:
+		return "bigint"
+	case UpdateAttrFloat:
+		return "float"
+	case UpdateAttrTimestamp:
+		return "timestamp"
+	case UpdateAttrMva32:
+		return "mva32"
+	case UpdateAttrMva64:
+		return "mva64"
+	case UpdateAttrString:
+		return "string"
+	case UpdateAttrJson:
+		return "json"
+	case UpdateAttrJsonPath:
+		return "json path"
+	default:
+		return fmt.Sprintf("EUpdateAttrType(%d)", vl)
+	}
+}
+
+// UpdateAttr describes one attribute updated by UpdateAttributesEx(): it's name (or JSON path for UpdateAttrJsonPath)
+// and type.
+type UpdateAttr struct {
+	Name string
+	Type EUpdateAttrType
+}
+
+// updateAttrs converts legacy list of attributes of the same type into typed attributes
+func updateAttrs(attrs []string, vtype EUpdateType) ([]UpdateAttr, error) {
+	var tp EUpdateAttrType
+	switch vtype {
+	case UpdateInt:
+		tp = UpdateAttrInt
+	case UpdateMva:
+		tp = UpdateAttrMva32
+	case UpdateString:
+		tp = UpdateAttrString
+	case UpdateJson:
+		tp = UpdateAttrJson
+	default:
+		return nil, fmt.Errorf("invalid arguments (unknown update type %d)", vtype)
+	}
+	res := make([]UpdateAttr, len(attrs))
+	for i, attr := range attrs {
+		res[i] = UpdateAttr{attr, tp}
+	}
+	return res, nil
+}
+
+// updateInteger extracts integer of any Go type, returns false for non-integers and uint64 values beyond int64.
+func updateInteger(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// updateIntegers extracts slice of integers of any Go type
+func updateIntegers(val interface{}) ([]int64, bool) {
+	var res []int64
+	switch v := val.(type) {
+	case []uint32:
+		res = make([]int64, len(v))
+		for i, num := range v {
+			res[i] = int64(num)
+		}
+	case []int32:
+		res = make([]int64, len(v))
+		for i, num := range v {
+			res[i] = int64(num)
+		}
+	case []int:
+		res = make([]int64, len(v))
+		for i, num := range v {
+			res[i] = int64(num)
+		}
+	case []int64:
+		res = make([]int64, len(v))
+		copy(res, v)
+	case []uint64:
+		res = make([]int64, len(v))
+		for i, num := range v {
+			if num > math.MaxInt64 {
+				return nil, false
+			}
+			res[i] = int64(num)
+		}
+	default:
+		return nil, false
+	}
+	return res, true
+}
+
+// checkUpdateValue validates value of attribute with type `tp` and converts it into canonical form: int64 for
+// integers and timestamps, float32 for floats, []int64 for MVA, string for strings and JSON, and int64 or float64
+// for JSON path.
+func checkUpdateValue(tp EUpdateAttrType, val interface{}) (interface{}, error) {
+	switch tp {
+	case UpdateAttrInt:
+		num, ok := updateInteger(val)
+		if !ok {
+			return nil, fmt.Errorf("integer expected, got %T", val)
+		}
+		if num < math.MinInt32 || num > math.MaxUint32 {
+			return nil, fmt.Errorf("value %d is out of 32-bit range", num)
+		}
+		return num, nil
+	case UpdateAttrBigint:
+		num, ok := updateInteger(val)
+		if !ok {
+			return nil, fmt.Errorf("integer expected, got %T", val)
+		}
+		return num, nil
+	case UpdateAttrFloat:
+		switch v := val.(type) {
+		case float32:
+			return v, nil
+		case float64:
+			return float32(v), nil
+		}
+		num, ok := updateInteger(val)
+		if !ok {
+			return nil, fmt.Errorf("number expected, got %T", val)
+		}
+		return float32(num), nil
+	case UpdateAttrTimestamp:
+		num, ok := updateInteger(val)
+		if tm, istime := val.(time.Time); istime {
+			num, ok = tm.Unix(), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("time.Time or integer expected, got %T", val)
+		}
+		if num < 0 || num > math.MaxUint32 {
+			return nil, fmt.Errorf("timestamp %d is out of range", num)
+		}
+		return num, nil
+	case UpdateAttrMva32, UpdateAttrMva64:
+		nums, ok := updateIntegers(val)
+		if !ok {
+			return nil, fmt.Errorf("slice of integers expected, got %T", val)
+		}
+		if tp == UpdateAttrMva32 {
+			for _, num := range nums {
+				if num < 0 || num > math.MaxUint32 {
+					return nil, fmt.Errorf("value %d is out of uint32 range", num)
+				}
+			}
+		}
+		return nums, nil
+	case UpdateAttrString:
+		str, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("string expected, got %T", val)
+		}
+		return str, nil
+	case UpdateAttrJson:
+		var raw []byte
+		switch v := val.(type) {
+		case string:
+			raw = []byte(v)
+		case []byte:
+			raw = v
+		case json.RawMessage:
+			raw = v
+		default:
+			blob, err := json.Marshal(val)
+			if err != nil {
+				return nil, err
+			}
+			return string(blob), nil
+		}
+		if !json.Valid(raw) {
+			return nil, errors.New("invalid JSON")
+		}
+		return string(raw), nil
+	case UpdateAttrJsonPath:
+		switch v := val.(type) {
+		case float32:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+		num, ok := updateInteger(val)
+		if !ok {
+			return nil, fmt.Errorf("number expected, got %T", val)
+		}
+		return num, nil
+	}
+	return nil, fmt.Errorf("unknown attribute type %d", tp)
+}
+
+// checkUpdateValues validates all the values against attributes, and returns sorted list of document IDs and values
+// in canonical form (see checkUpdateValue).
+func checkUpdateValues(attrs []UpdateAttr, values map[DocID][]interface{}) ([]DocID, map[DocID][]interface{}, error) {
+	for _, attr := range attrs {
+		if attr.Name == "" {
+			return nil, nil, errors.New("invalid arguments (attribute name must not be empty)")
+		}
+	}
+	ids := make([]DocID, 0, len(values))
+	checked := make(map[DocID][]interface{}, len(values))
+	for id, vals := range values {
+		if len(vals) != len(attrs) {
+			return nil, nil, fmt.Errorf("doc %d: %d values provided for %d attributes", id, len(vals), len(attrs))
+		}
+		row := make([]interface{}, len(vals))
+		for j, val := range vals {
+			var err error
+			if row[j], err = checkUpdateValue(attrs[j].Type, val); err != nil {
+				return nil, nil, fmt.Errorf("doc %d, attribute '%s' (%v): %v", id, attrs[j].Name, attrs[j].Type, err)
+			}
+		}
+		ids = append(ids, id)
+		checked[id] = row
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, checked, nil
+}
+
+// nativeUpdate checks whether all the attributes may be updated via API command (it supports only 32-bit integers,
+// 32-bit MVA, strings and whole JSONs); others are updated via sphinxql.
+func nativeUpdate(attrs []UpdateAttr) bool {
+	for _, attr := range attrs {
+		switch attr.Type {
+		case UpdateAttrInt, UpdateAttrTimestamp, UpdateAttrMva32, UpdateAttrString, UpdateAttrJson:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// buildUpdateRequest encodes update command. `values` must be already checked by checkUpdateValues(),
+// and attributes must be suitable for nativeUpdate().
+func buildUpdateRequest(index string, attrs []UpdateAttr, ids []DocID, values map[DocID][]interface{},
+	ignorenonexistent bool) func(*apibuf) {
 	nattrs := len(attrs)
-	nvalues := len(values)
 	return func(buf *apibuf) {
 		buf.putString(index)
 		buf.putLen(nattrs)
 		buf.putBoolDword(ignorenonexistent)
 
-		for j := 0; j < nattrs; j++ {
-			buf.putString(attrs[j])
-			buf.putDword(uint32(vtype))
+		for _, attr := range attrs {
+			buf.putString(attr.Name)
+			switch attr.Type {
+			case UpdateAttrMva32:
+				buf.putDword(uint32(UpdateMva))
+			case UpdateAttrString:
+				buf.putDword(uint32(UpdateString))
+			case UpdateAttrJson:
+				buf.putDword(uint32(UpdateJson))
+			default:
+				buf.putDword(uint32(UpdateInt))
+			}
 		}
 
-		buf.putLen(nvalues)
-		for key, value := range values {
-			buf.putDocid(key)
-			switch vtype {
-			case UpdateInt:
-				for j := 0; j < nattrs; j++ {
-					buf.putInt(int32(value[j].(int)))
-				}
-			case UpdateMva:
-				for j := 0; j < nattrs; j++ {
-					foo := value[j].([]uint32)
-					buf.putLen(len(foo))
-					for k := 0; k<len(foo); k++ {
-						buf.putDword(foo[k])
+		buf.putLen(len(ids))
+		for _, id := range ids {
+			buf.putDocid(id)
+			for j, value := range values[id] {
+				switch attrs[j].Type {
+				case UpdateAttrMva32:
+					nums := value.([]int64)
+					buf.putLen(len(nums))
+					for _, num := range nums {
+						buf.putDword(uint32(num))
 					}
+				case UpdateAttrString, UpdateAttrJson:
+					buf.putString(value.(string))
+				default:
+					buf.putDword(uint32(value.(int64)))
 				}
+			}
+		}
+	}
+}
 
-			case UpdateString:
-			case UpdateJson:
-				for j := 0; j < nattrs; j++ {
-					buf.putString(value[j].(string))
-				}
+// sqlUpdateValue formats checked value as sphinxql literal
+func sqlUpdateValue(tp EUpdateAttrType, value interface{}) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float32:
+		return formatSQLFloat(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []int64:
+		items := make([]string, len(v))
+		for i, num := range v {
+			items[i] = strconv.FormatInt(num, 10)
+		}
+		return "(" + strings.Join(items, ",") + ")"
+	case string:
+		return quoteSQLString(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// buildUpdateStatements makes one sphinxql UPDATE statement per index and document. `values` must be already checked
+// by checkUpdateValues().
+func buildUpdateStatements(index string, attrs []UpdateAttr, ids []DocID, values map[DocID][]interface{},
+	ignorenonexistent bool) []string {
+	var stmts []string
+	for _, idx := range splitIndexes(index) {
+		for _, id := range ids {
+			sets := make([]string, len(attrs))
+			for j, value := range values[id] {
+				sets[j] = attrs[j].Name + "=" + sqlUpdateValue(attrs[j].Type, value)
 			}
+			stmt := fmt.Sprintf("UPDATE %s SET %s WHERE id=%d", idx, strings.Join(sets, ", "), id)
+			if ignorenonexistent {
+				stmt += " OPTION ignore_nonexistent_columns=1"
+			}
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+/*
+UpdateAttributesEx works like UpdateAttributes(), but every attribute declares it's own type, so attributes of
+different types may be updated at once. Returns number of actually updated documents (0 or more) on success,
+or -1 on failure with error.
+
+`attrs` lists updated attributes with their types, see EUpdateAttrType for values accepted for every type.
+
+`values` is a map with documents IDs as keys and new attribute values, in the order of `attrs`.
+
+All the values are validated before sending, and the error names the document and attribute which value is wrong.
+
+Ints, timestamps, 32-bit MVAs, strings and whole JSONs are updated via single API command. If there are any bigint,
+float, 64-bit MVA or JSON path attributes (which API command can't update), the update is performed via sphinxql,
+with one UPDATE statement per index and document. In that case consider to open persistent connection with Open()
+before the call. Statements are sent one by one and are not atomic, so if one of them fails, the error is returned
+together with number of documents updated by the preceding ones (0 or more), instead of -1.
+
+Usage example:
+
+  upd, err := cl.UpdateAttributesEx("products", []UpdateAttr{
+    {"price", UpdateAttrFloat},
+    {"tags", UpdateAttrMva64},
+    {"meta.stock", UpdateAttrJsonPath},
+  }, map[DocID][]interface{}{1001: {19.99, []int64{1, 5000000000}, 12}}, false)
+*/
+func (cl *Client) UpdateAttributesEx(index string, attrs []UpdateAttr, values map[DocID][]interface{},
+	ignorenonexistent bool) (int, error) {
+
+	if len(attrs) == 0 {
+		return -1, errors.New("invalid arguments (attrs must not empty)")
+	}
+
+	if index == "" {
+		return -1, errors.New("invalid arguments (index must not be empty)")
+	}
+
+	if len(values) == 0 {
+		return -1, errors.New("invalid arguments (values must not be empty)")
+	}
+
+	ids, checked, err := checkUpdateValues(attrs, values)
+	if err != nil {
+		return -1, err
+	}
+
+	if nativeUpdate(attrs) {
+		updated, err := cl.netQuery(commandUpdate,
+			buildUpdateRequest(index, attrs, ids, checked, ignorenonexistent),
+			parseDwordAnswer())
+		if updated == nil {
+			return -1, err
+		}
+		return int(updated.(uint32)), err
+	}
+
+	total := 0
+	for _, stmt := range buildUpdateStatements(index, attrs, ids, checked, ignorenonexistent) {
+		rs, err := cl.sqlExec(stmt)
+		if err != nil {
+			return total, err
 		}
+		total += rs.RowsAffected
 	}
-}
\ No newline at end of file
+	return total, nil
+}
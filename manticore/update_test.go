@@ -2,7 +2,11 @@ package manticore
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestClient_UpdateAttributes(t *testing.T) {
@@ -27,4 +31,147 @@ func TestClient_UpdateAttributes_many(t *testing.T) {
 	} else {
 		fmt.Println(upd)
 	}
-}
\ No newline at end of file
+}
+
+func TestCheckUpdateValues(t *testing.T) {
+
+	attrs := []UpdateAttr{
+		{"gid", UpdateAttrInt},
+		{"big", UpdateAttrBigint},
+		{"price", UpdateAttrFloat},
+		{"ts", UpdateAttrTimestamp},
+		{"tags", UpdateAttrMva64},
+		{"meta", UpdateAttrJson},
+		{"meta.count", UpdateAttrJsonPath},
+	}
+	tm := time.Unix(1500000000, 0)
+	ids, checked, err := checkUpdateValues(attrs, map[DocID][]interface{}{
+		2: {uint32(7), uint64(5000000000), 19, tm, []int{1, 2}, map[string]int{"a": 1}, 1.5},
+		1: {-1, int64(-5), float32(2.5), 1500000000, []uint64{5000000000}, `{"a":1}`, 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("unexpected ids %v", ids)
+	}
+	expected := []interface{}{int64(7), int64(5000000000), float32(19), int64(1500000000), []int64{1, 2},
+		`{"a":1}`, float64(1.5)}
+	if !reflect.DeepEqual(checked[2], expected) {
+		t.Errorf("unexpected values %#v", checked[2])
+	}
+
+	wrong := []struct {
+		attr  UpdateAttr
+		value interface{}
+	}{
+		{UpdateAttr{"gid", UpdateAttrInt}, "1"},
+		{UpdateAttr{"gid", UpdateAttrInt}, int64(5000000000)},
+		{UpdateAttr{"big", UpdateAttrBigint}, uint64(math.MaxUint64)},
+		{UpdateAttr{"big", UpdateAttrBigint}, 1.5},
+		{UpdateAttr{"ts", UpdateAttrTimestamp}, -1},
+		{UpdateAttr{"tags", UpdateAttrMva32}, []uint64{5000000000}},
+		{UpdateAttr{"tags", UpdateAttrMva64}, []float32{1}},
+		{UpdateAttr{"title", UpdateAttrString}, 1},
+		{UpdateAttr{"meta", UpdateAttrJson}, `{"a":`},
+		{UpdateAttr{"meta.count", UpdateAttrJsonPath}, "1"},
+	}
+	for _, w := range wrong {
+		_, _, err := checkUpdateValues([]UpdateAttr{w.attr}, map[DocID][]interface{}{10: {w.value}})
+		if err == nil {
+			t.Errorf("%v %v: error expected", w.attr, w.value)
+		} else if !strings.HasPrefix(err.Error(), "doc 10, attribute '"+w.attr.Name+"'") {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	// empty MVA is valid, it resets the attribute
+	if _, _, err = checkUpdateValues(attrs[4:5], map[DocID][]interface{}{1: {[]uint32{}}}); err != nil {
+		t.Errorf("empty mva: unexpected error %v", err)
+	}
+
+	_, _, err = checkUpdateValues(attrs[:2], map[DocID][]interface{}{1: {1}})
+	if err == nil || err.Error() != "doc 1: 1 values provided for 2 attributes" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestBuildUpdateRequest(t *testing.T) {
+
+	attrs := []UpdateAttr{{"gid", UpdateAttrInt}, {"tags", UpdateAttrMva32}, {"title", UpdateAttrString},
+		{"meta", UpdateAttrJson}}
+	if !nativeUpdate(attrs) {
+		t.Fatal("attributes must be updated natively")
+	}
+	ids, checked, err := checkUpdateValues(attrs, map[DocID][]interface{}{
+		5: {-1, []uint32{3, 4}, "hello", `{"a":1}`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf apibuf
+	buildUpdateRequest("lj", attrs, ids, checked, true)(&buf)
+	if buf.getString() != "lj" || buf.getDword() != 4 || buf.getDword() != 1 {
+		t.Fatal("unexpected header")
+	}
+	for _, expected := range []EUpdateType{UpdateInt, UpdateMva, UpdateString, UpdateJson} {
+		name := buf.getString()
+		if tp := EUpdateType(buf.getDword()); tp != expected {
+			t.Errorf("attribute %s: type %d instead of %d", name, tp, expected)
+		}
+	}
+	if buf.getDword() != 1 || buf.getDocid() != 5 {
+		t.Fatal("unexpected docs")
+	}
+	if gid := buf.getDword(); gid != math.MaxUint32 {
+		t.Errorf("unexpected gid %d", gid)
+	}
+	if buf.getDword() != 2 || buf.getDword() != 3 || buf.getDword() != 4 {
+		t.Error("unexpected mva")
+	}
+	if title, meta := buf.getString(), buf.getString(); title != "hello" || meta != `{"a":1}` {
+		t.Errorf("unexpected strings '%s', '%s'", title, meta)
+	}
+	if len(buf) != 0 {
+		t.Errorf("%d extra bytes", len(buf))
+	}
+}
+
+func TestBuildUpdateStatements(t *testing.T) {
+
+	attrs := []UpdateAttr{{"price", UpdateAttrFloat}, {"tags", UpdateAttrMva64}, {"title", UpdateAttrString},
+		{"meta.count", UpdateAttrJsonPath}}
+	if nativeUpdate(attrs) {
+		t.Fatal("attributes can't be updated natively")
+	}
+	ids, checked, err := checkUpdateValues(attrs, map[DocID][]interface{}{
+		2: {19.5, []int64{5000000000, 1}, "it's", 3},
+		1: {1, []int64{}, "", 0.25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := buildUpdateStatements("lj, rt", attrs, ids, checked, true)
+	expected := []string{
+		"UPDATE lj SET price=1.0, tags=(), title='', meta.count=0.25 WHERE id=1 OPTION ignore_nonexistent_columns=1",
+		"UPDATE lj SET price=19.5, tags=(5000000000,1), title='it\\'s', meta.count=3 WHERE id=2 OPTION ignore_nonexistent_columns=1",
+		"UPDATE rt SET price=1.0, tags=(), title='', meta.count=0.25 WHERE id=1 OPTION ignore_nonexistent_columns=1",
+		"UPDATE rt SET price=19.5, tags=(5000000000,1), title='it\\'s', meta.count=3 WHERE id=2 OPTION ignore_nonexistent_columns=1",
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("unexpected statements:\n%s", strings.Join(stmts, "\n"))
+	}
+}
+
+func TestClient_UpdateAttributesEx(t *testing.T) {
+
+	cl := NewClient()
+
+	upd, err := cl.UpdateAttributesEx("lj", []UpdateAttr{{"channel_id", UpdateAttrInt},
+		{"published", UpdateAttrTimestamp}}, map[DocID][]interface{}{5000000: {1, time.Now()}}, false)
+	if err != nil {
+		fmt.Println(err.Error())
+	} else {
+		fmt.Println(upd)
+	}
+}